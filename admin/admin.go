@@ -0,0 +1,354 @@
+package admin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/eatmoreapple/openwechat"
+	"gorm.io/gorm"
+	"log"
+	"rsc.io/qr"
+	"strings"
+	"sync"
+	"time"
+	"wechat-assistant/util/totp"
+)
+
+const (
+	issuer       = "wechat-assistant"
+	maxFailures  = 5                // 连续失败次数上限
+	lockDuration = 15 * time.Minute // 锁定时长
+)
+
+type (
+	// Admin 管理员动态密码信息
+	Admin struct {
+		ID          uint   `gorm:"primaryKey;autoIncrement"`
+		UID         string `gorm:"type:varchar(100)"`
+		WechatName  string `gorm:"type:varchar(255);uniqueIndex"`
+		Secret      string `gorm:"type:varchar(100)"`
+		Algorithm   string `gorm:"type:varchar(10)"`
+		Digits      int    `gorm:"type:int(2)"`
+		LastCounter int64  `gorm:"type:int(20)"` // 最后一次使用的时间步，防止重放
+		Time        int64  `gorm:"type:int(13)"`
+	}
+
+	failure struct {
+		count       int
+		last        time.Time // 最后一次失败时间
+		lockedUntil time.Time
+	}
+)
+
+// Manager 管理员身份验证
+type Manager struct {
+	Secret        string   `value:"bot.secret"`
+	DB            *gorm.DB `aware:"db"`
+	mutex         sync.Mutex
+	masterCounter int64               // 共享密钥最后一次使用的时间步
+	failures      map[string]*failure // 验证失败记录，按管理员记录和发送者id区分
+}
+
+func (m *Manager) BeanName() string {
+	return "adminManager"
+}
+
+func (m *Manager) BeanConstruct() {
+	m.failures = map[string]*failure{}
+}
+
+func (m *Manager) AfterPropertiesSet() {
+	if err := m.DB.AutoMigrate(&Admin{}); err != nil {
+		log.Fatalln("初始化管理员表出错", err)
+	}
+	if err := m.DB.AutoMigrate(&AuditLog{}); err != nil {
+		log.Fatalln("初始化审计日志表出错", err)
+	}
+	if _, err := totp.TOTPToken(m.Secret, time.Now().Unix()); err != nil {
+		log.Fatalln("初始化动态密码生成器出错", err)
+	}
+}
+
+// operator 指令的发送者，群消息为群内发送者，私聊消息为好友
+func operator(ctx *openwechat.MessageContext) (*openwechat.User, error) {
+	if ctx.IsSendByFriend() {
+		return ctx.Sender()
+	}
+	return ctx.SenderInGroup()
+}
+
+// Verify 验证发送者的动态密码。未登记任何管理员时使用共享密钥验证
+func (m *Manager) Verify(ctx *openwechat.MessageContext, code string) bool {
+	user, err := operator(ctx)
+	if err != nil {
+		return false
+	}
+	var count int64
+	m.DB.Model(&Admin{}).Count(&count)
+	return m.verify(user, code, count == 0)
+}
+
+// VerifyMaster 验证动态密码，管理员自身密码或共享密钥均可通过
+func (m *Manager) VerifyMaster(ctx *openwechat.MessageContext, code string) bool {
+	user, err := operator(ctx)
+	if err != nil {
+		return false
+	}
+	return m.verify(user, code, true)
+}
+
+func (m *Manager) verify(user *openwechat.User, code string, allowMaster bool) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	m.evict(now)
+	admin := m.find(user)
+	key := failureKey(admin, user)
+	if f, ok := m.failures[key]; ok && now.Before(f.lockedUntil) {
+		log.Println("验证已锁定", user.NickName, f.lockedUntil.Format(time.DateTime))
+		return false
+	}
+	if admin != nil {
+		adminKey := totp.NewKey(admin.Secret, admin.Algorithm, admin.Digits)
+		if counter, ok := adminKey.Verify(code, 1); ok && counter > admin.LastCounter {
+			res := m.DB.Model(&Admin{}).
+				Where("id = ? and last_counter < ?", admin.ID, counter).
+				Updates(map[string]interface{}{
+					"uid":          user.UserName,
+					"last_counter": counter,
+				})
+			if res.Error == nil && res.RowsAffected > 0 {
+				delete(m.failures, key)
+				return true
+			}
+		}
+	}
+	if allowMaster {
+		masterKey := totp.NewKey(m.Secret, totp.AlgorithmSHA1, 6)
+		if counter, ok := masterKey.Verify(code, 1); ok && counter > m.masterCounter {
+			m.masterCounter = counter
+			delete(m.failures, key)
+			return true
+		}
+	}
+	m.fail(key, now)
+	log.Println("验证失败", now.Format(time.DateTime), user.NickName)
+	return false
+}
+
+// failureKey 验证失败记录的key，由管理员记录和发送者id组成，改名或冒用昵称都不会影响其他人的锁定状态
+func failureKey(admin *Admin, user *openwechat.User) string {
+	var id uint
+	if admin != nil {
+		id = admin.ID
+	}
+	return fmt.Sprintf("%d:%s", id, user.UserName)
+}
+
+func (m *Manager) fail(key string, now time.Time) {
+	f, ok := m.failures[key]
+	if !ok {
+		f = new(failure)
+		m.failures[key] = f
+	}
+	f.count++
+	f.last = now
+	if f.count >= maxFailures {
+		f.count = 0
+		f.lockedUntil = now.Add(lockDuration)
+	}
+}
+
+// evict 清理已解除锁定且长时间没有失败的记录
+func (m *Manager) evict(now time.Time) {
+	for key, f := range m.failures {
+		if now.After(f.lockedUntil) && now.Sub(f.last) > lockDuration {
+			delete(m.failures, key)
+		}
+	}
+}
+
+func (m *Manager) find(user *openwechat.User) *Admin {
+	admin := new(Admin)
+	if err := m.DB.Take(admin, "uid = ? or wechat_name = ?", user.UserName, user.NickName).Error; err != nil {
+		return nil
+	}
+	return admin
+}
+
+func (m *Manager) HandleManage(content string, ctx *openwechat.MessageContext) (ok bool, err error) {
+	// xxxxxx 指令 参数...
+	subCommands := strings.SplitN(content, " ", 3)
+	if len(subCommands) < 2 {
+		return
+	}
+	if !m.VerifyMaster(ctx, subCommands[0]) {
+		return
+	}
+	commands := subCommands[1:]
+	switch commands[0] {
+	case "enroll":
+		algorithm, digits := totp.AlgorithmSHA1, 6
+		if len(commands) > 1 {
+			for _, param := range strings.Fields(commands[1]) {
+				switch strings.ToUpper(param) {
+				case totp.AlgorithmSHA256:
+					algorithm = totp.AlgorithmSHA256
+				case "8":
+					digits = 8
+				}
+			}
+		}
+		if err := m.Enroll(ctx, algorithm, digits); err != nil {
+			return false, errors.New("登记管理员出错:" + err.Error())
+		}
+		_, _ = ctx.ReplyText("动态密码绑定信息已私聊发送，请查收")
+		return true, nil
+	case "remove":
+		if len(commands) == 1 {
+			return false, errors.New("命令格式错误:请输入微信昵称")
+		}
+		name := strings.TrimPrefix(strings.TrimSpace(commands[1]), "@")
+		res := m.DB.Where("wechat_name = ?", name).Delete(&Admin{})
+		if res.Error != nil {
+			return false, errors.New("移除管理员出错")
+		} else if res.RowsAffected == 0 {
+			_, _ = ctx.ReplyText(fmt.Sprintf("%s不是管理员", name))
+		} else {
+			_, _ = ctx.ReplyText(fmt.Sprintf("已移除管理员:%s", name))
+		}
+		return true, nil
+	case "list":
+		var admins []Admin
+		if err := m.DB.Find(&admins).Error; err != nil {
+			return false, errors.New("查询管理员列表出错")
+		}
+		if len(admins) == 0 {
+			_, _ = ctx.ReplyText("当前没有登记管理员")
+			return true, nil
+		}
+		msg := "已登记的管理员如下:\n"
+		for _, v := range admins {
+			msg += fmt.Sprintf("%s(%s,%d位)\n", v.WechatName, v.Algorithm, v.Digits)
+		}
+		_, _ = ctx.ReplyText(msg)
+		return true, nil
+	case "audit":
+		query := AuditQuery{Limit: 10}
+		if group, err := ctx.Sender(); err == nil {
+			query.GID = group.UserName
+		}
+		if len(commands) > 1 {
+			_, _ = fmt.Sscan(commands[1], &query.Limit)
+		}
+		records, err := m.ListAudit(query)
+		if err != nil {
+			return false, errors.New("查询审计日志出错")
+		}
+		if len(records) == 0 {
+			_, _ = ctx.ReplyText("当前群没有管理操作记录")
+			return true, nil
+		}
+		msg := "最近的管理操作如下:\n"
+		for _, v := range records {
+			msg += fmt.Sprintf("%s %s #%s %s [%s]\n", time.Unix(v.Time, 0).Format(time.DateTime), v.Username, v.Command, v.Args, v.Outcome)
+		}
+		_, _ = ctx.ReplyText(msg)
+		return true, nil
+	}
+	return false, nil
+}
+
+// Enroll 为消息发送者生成专属密钥，并通过私聊发送otpauth地址和二维码，群聊和私聊均可登记
+func (m *Manager) Enroll(ctx *openwechat.MessageContext, algorithm string, digits int) error {
+	user, err := operator(ctx)
+	if err != nil {
+		return err
+	}
+	friends, err := ctx.Owner().Friends()
+	if err != nil {
+		return err
+	}
+	friend := friends.SearchByUserName(1, user.UserName).First()
+	if friend == nil {
+		friend = friends.SearchByNickName(1, user.NickName).First()
+	}
+	if friend == nil {
+		return errors.New("请先添加机器人为好友")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return err
+	}
+	key := totp.NewKey(secret, algorithm, digits)
+	uri := key.URI(issuer, user.NickName)
+	code, err := qr.Encode(uri, qr.M)
+	if err != nil {
+		return err
+	}
+
+	admin := m.find(user)
+	if admin == nil {
+		admin = &Admin{WechatName: user.NickName}
+	}
+	admin.UID = user.UserName
+	admin.Secret = key.Secret
+	admin.Algorithm = key.Algorithm
+	admin.Digits = key.Digits
+	admin.LastCounter = 0
+	admin.Time = time.Now().Unix()
+	if err := m.DB.Save(admin).Error; err != nil {
+		return errors.New("保存管理员信息出错")
+	}
+
+	if _, err := friend.SendText("请使用认证器扫描二维码或导入以下地址:\n" + uri); err != nil {
+		return err
+	}
+	if _, err := friend.SendImage(bytes.NewReader(code.PNG())); err != nil {
+		return err
+	}
+	log.Println("已登记管理员", user.NickName, key.Algorithm, key.Digits)
+	return nil
+}
+
+// NotifyAdmins 私聊通知当前群内已登记的管理员，返回通知人数
+func (m *Manager) NotifyAdmins(ctx *openwechat.MessageContext, text string) int {
+	var admins []Admin
+	if err := m.DB.Find(&admins).Error; err != nil || len(admins) == 0 {
+		return 0
+	}
+	sender, err := ctx.Sender()
+	if err != nil {
+		return 0
+	}
+	group, ok := sender.AsGroup()
+	if !ok {
+		return 0
+	}
+	members, _ := group.Members()
+	friends, err := ctx.Owner().Friends()
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, admin := range admins {
+		if members.SearchByUserName(1, admin.UID).First() == nil && members.SearchByNickName(1, admin.WechatName).First() == nil {
+			continue
+		}
+		friend := friends.SearchByUserName(1, admin.UID).First()
+		if friend == nil {
+			friend = friends.SearchByNickName(1, admin.WechatName).First()
+		}
+		if friend == nil {
+			continue
+		}
+		if _, err := friend.SendText(text); err != nil {
+			log.Println("通知管理员失败", admin.WechatName, err)
+		} else {
+			count++
+		}
+	}
+	return count
+}
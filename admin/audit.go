@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	SourceChat = "chat"
+	SourceHTTP = "http"
+	SourceMQTT = "mqtt"
+)
+
+// AuditLog 管理操作审计记录
+type AuditLog struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	Source    string `gorm:"type:varchar(10)"`  // 来源,chat/http/mqtt
+	UID       string `gorm:"type:varchar(100)"` // 操作人id
+	Username  string `gorm:"type:varchar(255)"` // 操作人名称
+	GID       string `gorm:"type:varchar(100)"` // 群id
+	GroupName string `gorm:"type:varchar(255)"` // 群名称
+	Command   string `gorm:"type:varchar(50)"`  // 命令
+	Args      string ``                         // 参数,动态密码已脱敏
+	Outcome   string ``                         // 执行结果
+	Time      int64  `gorm:"type:int(13);index"`
+}
+
+// AuditQuery 审计记录查询条件
+type AuditQuery struct {
+	GID     string `form:"gid"`
+	UID     string `form:"uid"`
+	Command string `form:"command"`
+	Limit   int    `form:"limit"`
+}
+
+// RedactCode 将参数中的动态密码替换为掩码
+func RedactCode(content string) string {
+	parts := strings.SplitN(content, " ", 2)
+	parts[0] = "******"
+	return strings.Join(parts, " ")
+}
+
+// Outcome 根据执行结果生成描述
+func Outcome(ok bool, err error) string {
+	if err != nil {
+		return "失败:" + err.Error()
+	} else if ok {
+		return "成功"
+	}
+	return "未执行"
+}
+
+// Audit 记录管理操作
+func (m *Manager) Audit(record AuditLog) {
+	if record.Time == 0 {
+		record.Time = time.Now().Unix()
+	}
+	if err := m.DB.Create(&record).Error; err != nil {
+		log.Println("记录审计日志出错", err)
+	}
+}
+
+// AuditChat 记录聊天中发起的管理操作
+func (m *Manager) AuditChat(ctx *openwechat.MessageContext, command string, content string, ok bool, err error) {
+	record := AuditLog{
+		Source:  SourceChat,
+		Command: command,
+		Args:    RedactCode(content),
+		Outcome: Outcome(ok, err),
+	}
+	if group, e := ctx.Sender(); e == nil && group.IsGroup() {
+		record.GID = group.UserName
+		record.GroupName = group.NickName
+	}
+	if user, e := operator(ctx); e == nil {
+		record.UID = user.UserName
+		record.Username = user.NickName
+	}
+	m.Audit(record)
+}
+
+// ListAudit 查询审计记录，按时间倒序
+func (m *Manager) ListAudit(query AuditQuery) ([]AuditLog, error) {
+	if query.Limit <= 0 || query.Limit > 500 {
+		query.Limit = 50
+	}
+	tx := m.DB.Model(&AuditLog{})
+	if query.GID != "" {
+		tx = tx.Where("g_id = ?", query.GID)
+	}
+	if query.UID != "" {
+		tx = tx.Where("uid = ?", query.UID)
+	}
+	if query.Command != "" {
+		tx = tx.Where("command = ?", query.Command)
+	}
+	var records []AuditLog
+	err := tx.Order("id desc").Limit(query.Limit).Find(&records).Error
+	return records, err
+}
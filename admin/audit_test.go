@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"errors"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestRedactCode(t *testing.T) {
+	cases := map[string]string{
+		"123456":             "******",
+		"123456 list":        "****** list",
+		"123456 bind demo 1": "****** bind demo 1",
+	}
+	for content, want := range cases {
+		if got := RedactCode(content); got != want {
+			t.Errorf("%s: 期望%q, 实际%q", content, want, got)
+		}
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	if got := Outcome(true, nil); got != "成功" {
+		t.Errorf("期望成功, 实际%s", got)
+	}
+	if got := Outcome(false, nil); got != "未执行" {
+		t.Errorf("期望未执行, 实际%s", got)
+	}
+	if got := Outcome(true, errors.New("出错")); got != "失败:出错" {
+		t.Errorf("期望失败, 实际%s", got)
+	}
+}
+
+func TestListAudit(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&AuditLog{}); err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{DB: db}
+	m.Audit(AuditLog{Source: SourceChat, GID: "g1", UID: "u1", Command: "插件", Args: RedactCode("123456 list")})
+	m.Audit(AuditLog{Source: SourceChat, GID: "g2", UID: "u1", Command: "禁用词"})
+	m.Audit(AuditLog{Source: SourceHTTP, UID: "u2", Command: "插件"})
+
+	records, err := m.ListAudit(AuditQuery{UID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].GID != "g2" || records[1].Args != "****** list" {
+		t.Fatalf("按操作人查询结果错误 %v", records)
+	}
+	if records[0].Time == 0 {
+		t.Fatal("未记录操作时间")
+	}
+	if records, _ := m.ListAudit(AuditQuery{GID: "g1", Command: "插件"}); len(records) != 1 {
+		t.Fatalf("按群和命令查询结果错误 %v", records)
+	}
+	if records, _ := m.ListAudit(AuditQuery{Limit: 1}); len(records) != 1 || records[0].UID != "u2" {
+		t.Fatalf("查询数量限制错误 %v", records)
+	}
+}
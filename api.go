@@ -8,14 +8,25 @@ import (
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
+	"wechat-assistant/admin"
+	"wechat-assistant/bot"
+	"wechat-assistant/plugin"
 	"wechat-assistant/redirect"
 )
 
 type WebContainer struct {
-	Port          int                 `value:"app.port"`
-	Bot           *openwechat.Bot     `aware:"bot"`
-	MessageSender *redirect.MsgSender `aware:""`
+	Port          int                          `value:"app.port"`
+	Bot           *openwechat.Bot              `aware:"bot"`
+	MessageSender *redirect.MsgSender          `aware:""`
+	AdminManager  *admin.Manager               `aware:""`
+	Forbidden     *bot.KeywordForbiddenManager `aware:""`
+	AutoReply     *bot.AutoReplyManager        `aware:""`
+	Schedule      *bot.ScheduleManager         `aware:""`
+	MsgHandler    *bot.MsgHandler              `aware:""`
+	Welcome       *bot.WelcomeManager          `aware:""`
+	PluginManager *plugin.Manager              `aware:""`
 	router        *gin.Engine
 	server        *http.Server
 }
@@ -32,6 +43,21 @@ func (w *WebContainer) BeanConstruct() {
 	w.router.GET("/groups", w.nocache, w.getGroups)
 	w.router.GET("/group", w.nocache, w.getGroupInfo)
 	w.router.GET("/group/:gid", w.nocache, w.getGroupInfo)
+	w.router.GET("/audit", w.nocache, w.getAuditLogs)
+	w.router.GET("/forbidden", w.nocache, w.getForbiddenRules)
+	w.router.GET("/autoreply", w.nocache, w.getAutoReplies)
+	w.router.POST("/autoreply", w.nocache, w.saveAutoReply)
+	w.router.DELETE("/autoreply/:id", w.nocache, w.deleteAutoReply)
+	w.router.GET("/schedule", w.nocache, w.getSchedules)
+	w.router.POST("/schedule", w.nocache, w.saveSchedule)
+	w.router.DELETE("/schedule/:id", w.nocache, w.deleteSchedule)
+	w.router.GET("/queue", w.nocache, w.getQueueStats)
+	w.router.GET("/welcome", w.nocache, w.getWelcomeSettings)
+	w.router.POST("/welcome", w.nocache, w.saveWelcomeSetting)
+	w.router.DELETE("/welcome/:id", w.nocache, w.deleteWelcomeSetting)
+	w.router.GET("/plugin/jobs", w.nocache, w.getPluginJobs)
+	w.router.GET("/plugin/:id/config", w.nocache, w.getPluginConfigs)
+	w.router.POST("/plugin/:id/config", w.nocache, w.savePluginConfig)
 }
 
 func (w *WebContainer) nocache(c *gin.Context) {
@@ -104,6 +130,15 @@ func (w *WebContainer) sendMsg(c *gin.Context) {
 			msgId, err = w.MessageSender.SendGroupMediaMsgByGroupName(req.GroupName, req.Type, req.Body, req.Filename, req.Prompt)
 		}
 	}
+	w.AdminManager.Audit(admin.AuditLog{
+		Source:    admin.SourceHTTP,
+		UID:       c.ClientIP(),
+		GID:       req.Gid,
+		GroupName: req.GroupName,
+		Command:   "sendMessage",
+		Args:      fmt.Sprintf("type=%d body=%s", req.Type, req.Body),
+		Outcome:   admin.Outcome(err == nil, err),
+	})
 	if err != nil {
 		c.JSON(200, gin.H{
 			"code":  500,
@@ -118,6 +153,30 @@ func (w *WebContainer) sendMsg(c *gin.Context) {
 	}
 }
 
+func (w *WebContainer) getAuditLogs(c *gin.Context) {
+	query := admin.AuditQuery{}
+	if err := c.BindQuery(&query); err != nil {
+		c.JSON(200, gin.H{
+			"code":  400,
+			"error": err.Error(),
+		})
+		return
+	}
+	records, err := w.AdminManager.ListAudit(query)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  500,
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code":  0,
+		"error": "",
+		"data":  records,
+	})
+}
+
 func (w *WebContainer) getGroups(c *gin.Context) {
 	_, update := c.GetQuery("update")
 	self, err := w.getSelf()
@@ -195,6 +254,327 @@ func (w *WebContainer) getGroupInfo(c *gin.Context) {
 	})
 }
 
+func (w *WebContainer) getForbiddenRules(c *gin.Context) {
+	rules, err := w.Forbidden.ListRules(c.Query("gid"), c.Query("groupName"))
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  500,
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code":  0,
+		"error": "",
+		"data":  rules,
+	})
+}
+
+func (w *WebContainer) getAutoReplies(c *gin.Context) {
+	rules, err := w.AutoReply.List(c.Query("gid"), c.Query("groupName"))
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  500,
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code":  0,
+		"error": "",
+		"data":  rules,
+	})
+}
+
+func (w *WebContainer) saveAutoReply(c *gin.Context) {
+	rule := new(bot.AutoReply)
+	if err := c.BindJSON(rule); err != nil {
+		c.JSON(200, gin.H{
+			"code":  400,
+			"error": err.Error(),
+		})
+		return
+	}
+	err := w.AutoReply.Save(rule)
+	w.AdminManager.Audit(admin.AuditLog{
+		Source:  admin.SourceHTTP,
+		UID:     c.ClientIP(),
+		GID:     rule.Setting,
+		Command: "saveAutoReply",
+		Args:    fmt.Sprintf("id=%d keyword=%s reply=%s", rule.ID, rule.Keyword, rule.Reply),
+		Outcome: admin.Outcome(err == nil, err),
+	})
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  400,
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code":  0,
+		"error": "",
+		"data":  rule,
+	})
+}
+
+func (w *WebContainer) deleteAutoReply(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  400,
+			"error": "id格式错误",
+		})
+		return
+	}
+	ok, err := w.AutoReply.Delete(uint(id))
+	w.AdminManager.Audit(admin.AuditLog{
+		Source:  admin.SourceHTTP,
+		UID:     c.ClientIP(),
+		Command: "deleteAutoReply",
+		Args:    fmt.Sprintf("id=%d", id),
+		Outcome: admin.Outcome(ok, err),
+	})
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  500,
+			"error": err.Error(),
+		})
+	} else if !ok {
+		c.JSON(200, gin.H{
+			"code":  404,
+			"error": "规则不存在",
+		})
+	} else {
+		c.JSON(200, gin.H{
+			"code":  0,
+			"error": "",
+		})
+	}
+}
+
+func (w *WebContainer) getSchedules(c *gin.Context) {
+	messages, err := w.Schedule.List(c.Query("gid"), c.Query("groupName"))
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  500,
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code":  0,
+		"error": "",
+		"data":  messages,
+	})
+}
+
+func (w *WebContainer) saveSchedule(c *gin.Context) {
+	msg := new(bot.ScheduledMessage)
+	if err := c.BindJSON(msg); err != nil {
+		c.JSON(200, gin.H{
+			"code":  400,
+			"error": err.Error(),
+		})
+		return
+	}
+	err := w.Schedule.Save(msg)
+	w.AdminManager.Audit(admin.AuditLog{
+		Source:    admin.SourceHTTP,
+		UID:       c.ClientIP(),
+		GID:       msg.GID,
+		GroupName: msg.GroupName,
+		Command:   "saveSchedule",
+		Args:      fmt.Sprintf("id=%d spec=%s runAt=%d body=%s", msg.ID, msg.Spec, msg.RunAt, msg.Body),
+		Outcome:   admin.Outcome(err == nil, err),
+	})
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  400,
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code":  0,
+		"error": "",
+		"data":  msg,
+	})
+}
+
+func (w *WebContainer) deleteSchedule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  400,
+			"error": "id格式错误",
+		})
+		return
+	}
+	ok, err := w.Schedule.Delete(uint(id), "", "")
+	w.AdminManager.Audit(admin.AuditLog{
+		Source:  admin.SourceHTTP,
+		UID:     c.ClientIP(),
+		Command: "deleteSchedule",
+		Args:    fmt.Sprintf("id=%d", id),
+		Outcome: admin.Outcome(ok, err),
+	})
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  500,
+			"error": err.Error(),
+		})
+	} else if !ok {
+		c.JSON(200, gin.H{
+			"code":  404,
+			"error": "定时消息不存在",
+		})
+	} else {
+		c.JSON(200, gin.H{
+			"code":  0,
+			"error": "",
+		})
+	}
+}
+
+func (w *WebContainer) getWelcomeSettings(c *gin.Context) {
+	settings, err := w.Welcome.List()
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  500,
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code":  0,
+		"error": "",
+		"data":  settings,
+	})
+}
+
+func (w *WebContainer) saveWelcomeSetting(c *gin.Context) {
+	setting := new(bot.WelcomeSetting)
+	if err := c.BindJSON(setting); err != nil {
+		c.JSON(200, gin.H{
+			"code":  400,
+			"error": err.Error(),
+		})
+		return
+	}
+	err := w.Welcome.Save(setting)
+	w.AdminManager.Audit(admin.AuditLog{
+		Source:  admin.SourceHTTP,
+		UID:     c.ClientIP(),
+		Command: "saveWelcome",
+		Args:    fmt.Sprintf("id=%d setting=%s template=%s image=%s", setting.ID, setting.Setting, setting.Template, setting.Image),
+		Outcome: admin.Outcome(err == nil, err),
+	})
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  400,
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code":  0,
+		"error": "",
+		"data":  setting,
+	})
+}
+
+func (w *WebContainer) deleteWelcomeSetting(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  400,
+			"error": "id格式错误",
+		})
+		return
+	}
+	ok, err := w.Welcome.Delete(uint(id))
+	w.AdminManager.Audit(admin.AuditLog{
+		Source:  admin.SourceHTTP,
+		UID:     c.ClientIP(),
+		Command: "deleteWelcome",
+		Args:    fmt.Sprintf("id=%d", id),
+		Outcome: admin.Outcome(ok, err),
+	})
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  500,
+			"error": err.Error(),
+		})
+	} else if !ok {
+		c.JSON(200, gin.H{
+			"code":  404,
+			"error": "入群欢迎设置不存在",
+		})
+	} else {
+		c.JSON(200, gin.H{
+			"code":  0,
+			"error": "",
+		})
+	}
+}
+
+func (w *WebContainer) getPluginJobs(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"code":  0,
+		"error": "",
+		"data":  w.PluginManager.Jobs(),
+	})
+}
+
+func (w *WebContainer) getPluginConfigs(c *gin.Context) {
+	values, err := w.PluginManager.Configs(c.Param("id"))
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  500,
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code":  0,
+		"error": "",
+		"data":  values,
+	})
+}
+
+func (w *WebContainer) savePluginConfig(c *gin.Context) {
+	id := c.Param("id")
+	req := new(pluginConfigRequest)
+	if err := c.BindJSON(req); err != nil {
+		c.JSON(200, gin.H{
+			"code":  400,
+			"error": err.Error(),
+		})
+		return
+	}
+	err := w.PluginManager.SetConfig(id, req.Key, req.Value)
+	// 配置值可能为密钥，不记录到审计日志
+	w.AdminManager.Audit(admin.AuditLog{
+		Source:  admin.SourceHTTP,
+		UID:     c.ClientIP(),
+		Command: "savePluginConfig",
+		Args:    fmt.Sprintf("id=%s key=%s", id, req.Key),
+		Outcome: admin.Outcome(err == nil, err),
+	})
+	if err != nil {
+		c.JSON(200, gin.H{
+			"code":  400,
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"code":  0,
+		"error": "",
+	})
+}
+
 type (
 	apiRequest struct {
 		Gid       string `json:"gid" form:"gid"`           // 群id
@@ -205,6 +585,11 @@ type (
 		Prompt    string `json:"prompt" form:"prompt"`     // 发送媒体资源前的提示词,会自动撤回
 	}
 
+	pluginConfigRequest struct {
+		Key   string `json:"key"`
+		Value string `json:"value"` // 为空时恢复默认值
+	}
+
 	group struct {
 		Gid  string  `json:"gid"`
 		Name string  `json:"name"`
@@ -217,3 +602,12 @@ type (
 		AttrStatus  int    `json:"attrStatus"`
 	}
 )
+
+// getQueueStats 消息处理队列指标
+func (w *WebContainer) getQueueStats(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"code":  0,
+		"error": "",
+		"data":  w.MsgHandler.QueueStats(),
+	})
+}
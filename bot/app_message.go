@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"net/url"
+	"strconv"
+	"strings"
+	"wechat-assistant/redirect"
+)
+
+const (
+	PayloadKey = "payload"
+
+	PayloadLink        = "link"
+	PayloadMiniProgram = "miniprogram"
+	PayloadFile        = "file"
+	PayloadCard        = "card"
+	PayloadLocation    = "location"
+	PayloadApp         = "app"
+
+	// AppMsgTypeMiniProgram 小程序消息
+	AppMsgTypeMiniProgram openwechat.AppMessageType = 33
+	// AppMsgTypeMiniProgramPage 小程序页面消息
+	AppMsgTypeMiniProgramPage openwechat.AppMessageType = 36
+)
+
+// ParsePayload 解析链接、小程序、文件、名片、位置消息的结构化内容，其他消息返回nil
+func ParsePayload(msg *openwechat.Message) *redirect.Payload {
+	switch {
+	case msg.IsLocation():
+		return parseLocation(msg.Content, msg.Url)
+	case msg.IsCard():
+		card, err := msg.Card()
+		if err != nil {
+			return nil
+		}
+		return &redirect.Payload{
+			Kind:      PayloadCard,
+			CardUser:  card.UserName,
+			CardName:  card.NickName,
+			CardAlias: card.Alias,
+			URL:       card.BigHeadImgUrl,
+		}
+	case msg.IsMedia() && !isReferMsg(msg):
+		data, err := msg.MediaData()
+		if err != nil {
+			return nil
+		}
+		payload := &redirect.Payload{
+			Kind:        PayloadApp,
+			Title:       data.AppMsg.Title,
+			Description: data.AppMsg.Des,
+			URL:         data.AppMsg.URL,
+			AppName:     data.AppInfo.AppName,
+		}
+		if payload.AppName == "" {
+			payload.AppName = data.AppMsg.SourceDisplayName
+		}
+		switch data.AppMsg.Type {
+		case openwechat.AppMsgTypeUrl:
+			payload.Kind = PayloadLink
+		case openwechat.AppMsgTypeAttach:
+			payload.Kind = PayloadFile
+			payload.FileExt = data.AppMsg.AppAttach.FileExt
+			payload.FileSize, _ = strconv.ParseInt(data.AppMsg.AppAttach.TotalLen, 10, 64)
+		case AppMsgTypeMiniProgram, AppMsgTypeMiniProgramPage:
+			payload.Kind = PayloadMiniProgram
+			payload.AppID = data.AppMsg.WeAppInfo.Appid
+			payload.PagePath = data.AppMsg.WeAppInfo.PagePath
+		}
+		return payload
+	}
+	return nil
+}
+
+// parseLocation 解析位置消息，内容格式为 "位置描述:\n图片地址"，坐标在地图链接的coord参数中
+func parseLocation(content string, mapUrl string) *redirect.Payload {
+	payload := &redirect.Payload{Kind: PayloadLocation, URL: mapUrl}
+	if i := strings.Index(content, ":\n"); i > 0 {
+		payload.Label = content[:i]
+	}
+	u, err := url.Parse(mapUrl)
+	if err != nil {
+		return payload
+	}
+	coord := strings.Split(u.Query().Get("coord"), ",")
+	if len(coord) == 2 {
+		payload.Latitude, _ = strconv.ParseFloat(coord[0], 64)
+		payload.Longitude, _ = strconv.ParseFloat(coord[1], 64)
+	}
+	return payload
+}
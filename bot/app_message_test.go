@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"reflect"
+	"testing"
+	"wechat-assistant/redirect"
+)
+
+func TestParsePayload(t *testing.T) {
+	cases := []struct {
+		name string
+		msg  *openwechat.Message
+		want *redirect.Payload
+	}{
+		{
+			"链接",
+			&openwechat.Message{MsgType: openwechat.MsgTypeApp, Content: `<msg><appmsg><title>新闻</title><des>摘要</des><type>5</type>` +
+				`<url>https://example.com/a</url></appmsg><appinfo><appname>浏览器</appname></appinfo></msg>`},
+			&redirect.Payload{Kind: PayloadLink, Title: "新闻", Description: "摘要", URL: "https://example.com/a", AppName: "浏览器"},
+		},
+		{
+			"文件",
+			&openwechat.Message{MsgType: openwechat.MsgTypeApp, Content: `<msg><appmsg><title>报告.pdf</title><type>6</type>` +
+				`<appattach><totallen>2048</totallen><fileext>pdf</fileext></appattach></appmsg></msg>`},
+			&redirect.Payload{Kind: PayloadFile, Title: "报告.pdf", FileExt: "pdf", FileSize: 2048},
+		},
+		{
+			"小程序",
+			&openwechat.Message{MsgType: openwechat.MsgTypeApp, Content: `<msg><appmsg><title>点餐</title><type>33</type>` +
+				`<sourcedisplayname>外卖</sourcedisplayname><weappinfo><pagepath>pages/index</pagepath><appid>wx123</appid></weappinfo></appmsg></msg>`},
+			&redirect.Payload{Kind: PayloadMiniProgram, Title: "点餐", AppName: "外卖", AppID: "wx123", PagePath: "pages/index"},
+		},
+		{
+			"名片",
+			&openwechat.Message{MsgType: openwechat.MsgTypeShareCard, Content: `<msg username="@card" nickname="李四" alias="lisi" bigheadimgurl="https://example.com/head.jpg" />`},
+			&redirect.Payload{Kind: PayloadCard, CardUser: "@card", CardName: "李四", CardAlias: "lisi", URL: "https://example.com/head.jpg"},
+		},
+		{
+			"位置",
+			&openwechat.Message{MsgType: openwechat.MsgTypeText, Content: "公司大楼:\n/cgi-bin/mmwebwx-bin/webwxgetpubliclinkimg?pictype=location",
+				Url: "https://api.map.qq.com/uri/v1/geocoder?coord=22.5,113.9"},
+			&redirect.Payload{Kind: PayloadLocation, Label: "公司大楼", URL: "https://api.map.qq.com/uri/v1/geocoder?coord=22.5,113.9", Latitude: 22.5, Longitude: 113.9},
+		},
+		{
+			"引用消息",
+			&openwechat.Message{MsgType: openwechat.MsgTypeApp, AppMsgType: AppMsgTypeRefer, Content: `<msg><appmsg><type>57</type></appmsg></msg>`},
+			nil,
+		},
+		{
+			"文本",
+			&openwechat.Message{MsgType: openwechat.MsgTypeText, Content: "你好"},
+			nil,
+		},
+	}
+	for _, c := range cases {
+		if got := ParsePayload(c.msg); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: 期望%+v, 实际%+v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		mapUrl  string
+		want    redirect.Payload
+	}{
+		{"缺少坐标", "公司大楼:\n图片", "https://api.map.qq.com/uri/v1/geocoder", redirect.Payload{Kind: PayloadLocation, Label: "公司大楼", URL: "https://api.map.qq.com/uri/v1/geocoder"}},
+		{"缺少描述", "图片", "https://api.map.qq.com/uri/v1/geocoder?coord=1.5,2.5", redirect.Payload{Kind: PayloadLocation, URL: "https://api.map.qq.com/uri/v1/geocoder?coord=1.5,2.5", Latitude: 1.5, Longitude: 2.5}},
+		{"地址错误", "公司大楼:\n图片", "://", redirect.Payload{Kind: PayloadLocation, Label: "公司大楼", URL: "://"}},
+	}
+	for _, c := range cases {
+		if got := parseLocation(c.content, c.mapUrl); *got != c.want {
+			t.Errorf("%s: 期望%+v, 实际%+v", c.name, c.want, *got)
+		}
+	}
+}
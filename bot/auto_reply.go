@@ -0,0 +1,340 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/eatmoreapple/openwechat"
+	"gorm.io/gorm"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"wechat-assistant/admin"
+	"wechat-assistant/redirect"
+)
+
+const (
+	ReplyMatchExact    = "exact"
+	ReplyMatchContains = "contains"
+	ReplyMatchRegex    = "regex"
+)
+
+// AutoReply 关键词自动回复规则
+type AutoReply struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Setting   string `gorm:"type:varchar(255)" json:"setting"`  // 群id或群名称,空表示全局
+	MatchType string `gorm:"type:varchar(10)" json:"matchType"` // 匹配方式,exact/contains/regex
+	Keyword   string `gorm:"type:varchar(255)" json:"keyword"`  // 关键词
+	ReplyType int    `gorm:"type:int(2)" json:"replyType"`      // 回复类型 1:文本,2:图片,3:视频,4:文件
+	Reply     string `json:"reply"`                             // 回复内容,文本或资源地址,支持{name}{group}{time}{content}变量
+	Cooldown  int64  `gorm:"type:int(10)" json:"cooldown"`      // 冷却时长,单位秒
+	Enabled   bool   `json:"enabled"`                           // 是否启用
+	Time      int64  `gorm:"type:int(13)" json:"time"`
+}
+
+func (r AutoReply) String() string {
+	status := "启用"
+	if !r.Enabled {
+		status = "停用"
+	}
+	scope := ""
+	if r.Setting == "" {
+		scope = "(全局)"
+	}
+	return fmt.Sprintf("%d:[%s]%s%s 冷却%d秒 %s", r.ID, r.MatchType, r.Keyword, scope, r.Cooldown, status)
+}
+
+func (r AutoReply) validate() error {
+	switch r.MatchType {
+	case ReplyMatchExact, ReplyMatchContains:
+	case ReplyMatchRegex:
+		if _, err := regexp.Compile(r.Keyword); err != nil {
+			return errors.New("正则表达式错误:" + err.Error())
+		}
+	default:
+		return errors.New("匹配方式只能为exact/contains/regex")
+	}
+	if r.Keyword == "" || r.Reply == "" {
+		return errors.New("关键词和回复内容不能为空")
+	}
+	if r.ReplyType < 1 || r.ReplyType > 4 {
+		return errors.New("回复类型错误")
+	}
+	return nil
+}
+
+type AutoReplyManager struct {
+	DB         *gorm.DB            `aware:"db"`
+	Admin      *admin.Manager      `aware:""`
+	Sender     *redirect.MsgSender `aware:""`
+	mutex      sync.Mutex
+	lastReply  map[string]time.Time // 规则在群内最后一次回复时间
+	regexCache sync.Map
+}
+
+func (m *AutoReplyManager) BeanConstruct() {
+	m.lastReply = map[string]time.Time{}
+}
+
+func (m *AutoReplyManager) AfterPropertiesSet() {
+	if err := m.DB.AutoMigrate(&AutoReply{}); err != nil {
+		log.Fatalln("初始化自动回复表出错", err)
+	}
+}
+
+func (m *AutoReplyManager) match(rule AutoReply, content string) bool {
+	switch rule.MatchType {
+	case ReplyMatchExact:
+		return content == rule.Keyword
+	case ReplyMatchContains:
+		return strings.Contains(content, rule.Keyword)
+	case ReplyMatchRegex:
+		var re *regexp.Regexp
+		if v, ok := m.regexCache.Load(rule.Keyword); ok {
+			re = v.(*regexp.Regexp)
+		} else {
+			compiled, err := regexp.Compile(rule.Keyword)
+			if err != nil {
+				return false
+			}
+			m.regexCache.Store(rule.Keyword, compiled)
+			re = compiled
+		}
+		return re.MatchString(content)
+	}
+	return false
+}
+
+// cool 检查规则冷却状态，未冷却时记录本次回复时间并返回true
+func (m *AutoReplyManager) cool(rule AutoReply, gid string) bool {
+	key := fmt.Sprintf("%d:%s", rule.ID, gid)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if last, ok := m.lastReply[key]; ok && time.Since(last) < time.Duration(rule.Cooldown)*time.Second {
+		return false
+	}
+	m.lastReply[key] = time.Now()
+	return true
+}
+
+// Reply 按规则自动回复消息，返回是否已回复
+func (m *AutoReplyManager) Reply(ctx *openwechat.MessageContext) bool {
+	sender, err := ctx.Sender()
+	if err != nil {
+		return false
+	}
+	group, ok := sender.AsGroup()
+	if !ok {
+		return false
+	}
+	var rules []AutoReply
+	if err := m.DB.Where("enabled = ? and (setting = '' or setting = ? or setting = ?)", true, sender.UserName, sender.NickName).
+		Order("id").Find(&rules).Error; err != nil {
+		log.Println("查询自动回复规则出错", err)
+		return false
+	}
+	content := strings.TrimSpace(ctx.Content)
+	for _, rule := range rules {
+		if !m.match(rule, content) || !m.cool(rule, sender.UserName) {
+			continue
+		}
+		var username string
+		if user, err := ctx.SenderInGroup(); err == nil {
+			username = user.DisplayName
+			if username == "" {
+				username = user.NickName
+			}
+		}
+		reply := strings.NewReplacer(
+			"{name}", username,
+			"{group}", sender.NickName,
+			"{time}", time.Now().Format(time.DateTime),
+			"{content}", content,
+		).Replace(rule.Reply)
+		if rule.ReplyType == 1 {
+			_, err = m.Sender.SendGroupTextMsg(group, reply)
+		} else {
+			_, err = m.Sender.SendGroupMediaMsg(group, rule.ReplyType, reply, "", "")
+		}
+		if err != nil {
+			log.Println("自动回复失败", rule.ID, err)
+		}
+		return true
+	}
+	return false
+}
+
+// List 查询对群生效的自动回复规则，gid和groupName均为空时返回全部规则
+func (m *AutoReplyManager) List(gid string, groupName string) ([]AutoReply, error) {
+	var rules []AutoReply
+	tx := m.DB.Model(&AutoReply{})
+	if gid != "" || groupName != "" {
+		tx = tx.Where("setting = '' or setting = ? or setting = ?", gid, groupName)
+	}
+	err := tx.Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// Save 新增或更新自动回复规则
+func (m *AutoReplyManager) Save(rule *AutoReply) error {
+	if rule.ReplyType == 0 {
+		rule.ReplyType = 1
+	}
+	if err := rule.validate(); err != nil {
+		return err
+	}
+	rule.Time = time.Now().Unix()
+	if err := m.DB.Save(rule).Error; err != nil {
+		return err
+	}
+	m.pruneRegex()
+	return nil
+}
+
+// Delete 删除自动回复规则，settings不为空时只删除指定群的规则
+func (m *AutoReplyManager) Delete(id uint, settings ...string) (bool, error) {
+	tx := m.DB.Where("id = ?", id)
+	if len(settings) > 0 {
+		tx = tx.Where("setting in ?", settings)
+	}
+	res := tx.Delete(&AutoReply{})
+	if res.Error == nil && res.RowsAffected > 0 {
+		m.pruneRegex()
+	}
+	return res.RowsAffected > 0, res.Error
+}
+
+// pruneRegex 清除已不再使用的正则缓存
+func (m *AutoReplyManager) pruneRegex() {
+	var keywords []string
+	if err := m.DB.Model(&AutoReply{}).Where("match_type = ?", ReplyMatchRegex).Pluck("keyword", &keywords).Error; err != nil {
+		log.Println("查询自动回复规则出错", err)
+		return
+	}
+	used := make(map[string]bool, len(keywords))
+	for _, keyword := range keywords {
+		used[keyword] = true
+	}
+	m.regexCache.Range(func(key, _ any) bool {
+		if !used[key.(string)] {
+			m.regexCache.Delete(key)
+		}
+		return true
+	})
+}
+
+// groupSettings 群配置使用的群id和群名称，不包含空值，避免匹配到全局配置
+func groupSettings(group *openwechat.User) []string {
+	settings := make([]string, 0, 2)
+	for _, setting := range []string{group.UserName, group.NickName} {
+		if setting != "" {
+			settings = append(settings, setting)
+		}
+	}
+	return settings
+}
+
+func (m *AutoReplyManager) HandleManage(content string, ctx *openwechat.MessageContext) (ok bool, err error) {
+	subCommands := strings.SplitN(content, " ", 3)
+	if len(subCommands) < 2 {
+		return
+	}
+	if !m.Admin.Verify(ctx, subCommands[0]) {
+		return
+	}
+	sender, err := ctx.Sender()
+	if err != nil {
+		return false, err
+	}
+	commands := subCommands[1:]
+	switch commands[0] {
+	case "add", "global":
+		// add 匹配方式 关键词 回复内容，回复内容以image:/video:/file:开头时发送媒体
+		if len(commands) == 1 {
+			return false, errors.New("命令格式错误:请输入匹配方式、关键词和回复内容")
+		}
+		params := strings.SplitN(commands[1], " ", 3)
+		if len(params) < 3 {
+			return false, errors.New("命令格式错误:请输入匹配方式、关键词和回复内容")
+		}
+		rule := &AutoReply{MatchType: params[0], Keyword: params[1], ReplyType: 1, Reply: params[2], Enabled: true}
+		for prefix, replyType := range map[string]int{"image:": 2, "video:": 3, "file:": 4} {
+			if strings.HasPrefix(rule.Reply, prefix) {
+				rule.ReplyType = replyType
+				rule.Reply = strings.TrimPrefix(rule.Reply, prefix)
+			}
+		}
+		if commands[0] == "add" {
+			rule.Setting = sender.UserName
+		}
+		if err := m.Save(rule); err != nil {
+			return false, errors.New("添加自动回复出错:" + err.Error())
+		}
+		_, _ = ctx.ReplyText("已添加自动回复 " + rule.String())
+		return true, nil
+	case "cooldown", "enable", "disable", "del":
+		if len(commands) == 1 {
+			return false, errors.New("命令格式错误:请输入规则ID")
+		}
+		params := strings.Fields(commands[1])
+		id, err := strconv.ParseUint(params[0], 10, 64)
+		if err != nil {
+			return false, errors.New("命令格式错误:规则ID错误")
+		}
+		// 群内只能管理当前群的规则，全局规则通过管理接口维护
+		settings := groupSettings(sender)
+		if len(settings) == 0 {
+			return false, errors.New("未找到自动回复规则")
+		}
+		if commands[0] == "del" {
+			if ok, err := m.Delete(uint(id), settings...); err != nil {
+				return false, errors.New("删除自动回复出错")
+			} else if !ok {
+				_, _ = ctx.ReplyText("未找到自动回复规则")
+			} else {
+				_, _ = ctx.ReplyText("已删除自动回复规则")
+			}
+			return true, nil
+		}
+		rule := new(AutoReply)
+		if err := m.DB.Take(rule, "id = ? and setting in ?", id, settings).Error; err != nil {
+			return false, errors.New("未找到自动回复规则")
+		}
+		switch commands[0] {
+		case "cooldown":
+			if len(params) < 2 {
+				return false, errors.New("命令格式错误:请输入冷却时长(秒)")
+			}
+			if rule.Cooldown, err = strconv.ParseInt(params[1], 10, 64); err != nil {
+				return false, errors.New("命令格式错误:冷却时长错误")
+			}
+		case "enable":
+			rule.Enabled = true
+		case "disable":
+			rule.Enabled = false
+		}
+		if err := m.Save(rule); err != nil {
+			return false, errors.New("更新自动回复出错:" + err.Error())
+		}
+		_, _ = ctx.ReplyText("已更新自动回复 " + rule.String())
+		return true, nil
+	case "list":
+		rules, err := m.List(sender.UserName, sender.NickName)
+		if err != nil {
+			return false, errors.New("查询自动回复出错")
+		}
+		if len(rules) == 0 {
+			_, _ = ctx.ReplyText("当前群没有自动回复规则")
+			return true, nil
+		}
+		msg := "当前群的自动回复规则如下:\n"
+		for _, rule := range rules {
+			msg += rule.String() + "\n"
+		}
+		_, _ = ctx.ReplyText(msg)
+		return true, nil
+	}
+	return false, nil
+}
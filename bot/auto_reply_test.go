@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestAutoReplyMatch(t *testing.T) {
+	m := &AutoReplyManager{}
+	cases := []struct {
+		rule    AutoReply
+		content string
+		want    bool
+	}{
+		{AutoReply{MatchType: ReplyMatchExact, Keyword: "你好"}, "你好", true},
+		{AutoReply{MatchType: ReplyMatchExact, Keyword: "你好"}, "你好啊", false},
+		{AutoReply{MatchType: ReplyMatchContains, Keyword: "天气"}, "今天天气如何", true},
+		{AutoReply{MatchType: ReplyMatchContains, Keyword: "天气"}, "今天如何", false},
+		{AutoReply{MatchType: ReplyMatchRegex, Keyword: `^\d+号$`}, "12号", true},
+		{AutoReply{MatchType: ReplyMatchRegex, Keyword: `^\d+号$`}, "十二号", false},
+		{AutoReply{MatchType: ReplyMatchRegex, Keyword: `[`}, "[", false},
+		{AutoReply{MatchType: "unknown", Keyword: "你好"}, "你好", false},
+	}
+	for _, c := range cases {
+		if got := m.match(c.rule, c.content); got != c.want {
+			t.Errorf("%s %s %s: 期望%v, 实际%v", c.rule.MatchType, c.rule.Keyword, c.content, c.want, got)
+		}
+	}
+}
+
+func TestAutoReplyCooldown(t *testing.T) {
+	m := &AutoReplyManager{}
+	m.BeanConstruct()
+	rule := AutoReply{ID: 1, Cooldown: 60}
+	if !m.cool(rule, "@@group") {
+		t.Fatal("首次回复不应冷却")
+	}
+	if m.cool(rule, "@@group") {
+		t.Fatal("冷却时间内不应再次回复")
+	}
+	if !m.cool(rule, "@@other") {
+		t.Fatal("不同群之间的冷却互不影响")
+	}
+	m.lastReply["1:@@group"] = time.Now().Add(-time.Minute)
+	if !m.cool(rule, "@@group") {
+		t.Fatal("冷却结束后应可以回复")
+	}
+	if noCooldown := (AutoReply{ID: 2}); !m.cool(noCooldown, "@@group") || !m.cool(noCooldown, "@@group") {
+		t.Fatal("未设置冷却时长时每次都应回复")
+	}
+}
+
+func TestAutoReplyValidate(t *testing.T) {
+	cases := []struct {
+		rule AutoReply
+		ok   bool
+	}{
+		{AutoReply{MatchType: ReplyMatchExact, Keyword: "你好", Reply: "你好", ReplyType: 1}, true},
+		{AutoReply{MatchType: ReplyMatchRegex, Keyword: "[", Reply: "你好", ReplyType: 1}, false},
+		{AutoReply{MatchType: "prefix", Keyword: "你好", Reply: "你好", ReplyType: 1}, false},
+		{AutoReply{MatchType: ReplyMatchExact, Keyword: "你好", ReplyType: 1}, false},
+		{AutoReply{MatchType: ReplyMatchExact, Keyword: "你好", Reply: "你好", ReplyType: 5}, false},
+	}
+	for i, c := range cases {
+		if err := c.rule.validate(); (err == nil) != c.ok {
+			t.Errorf("%d: 期望%v, 实际%v", i, c.ok, err)
+		}
+	}
+}
+
+func TestAutoReplyDelete(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &AutoReplyManager{DB: db}
+	m.BeanConstruct()
+	m.AfterPropertiesSet()
+	group := &AutoReply{Setting: "测试群", MatchType: ReplyMatchRegex, Keyword: `^\d+$`, Reply: "数字"}
+	global := &AutoReply{MatchType: ReplyMatchExact, Keyword: "你好", Reply: "你好"}
+	for _, rule := range []*AutoReply{group, global} {
+		if err := m.Save(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settings := groupSettings(&openwechat.User{UserName: "@@group", NickName: "测试群"})
+	if ok, _ := m.Delete(global.ID, settings...); ok {
+		t.Fatal("群内不能删除全局规则")
+	}
+	if ok, _ := m.Delete(group.ID, "其他群"); ok {
+		t.Fatal("不能删除其他群的规则")
+	}
+	if !m.match(*group, "12") {
+		t.Fatal("正则规则应匹配")
+	}
+	if ok, err := m.Delete(group.ID, settings...); !ok || err != nil {
+		t.Fatalf("期望删除当前群的规则, 实际%v %v", ok, err)
+	}
+	if _, cached := m.regexCache.Load(group.Keyword); cached {
+		t.Fatal("删除规则后应清除正则缓存")
+	}
+}
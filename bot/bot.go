@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"fmt"
 	"github.com/eatmoreapple/openwechat"
 	"github.com/go-resty/resty/v2"
 	"github.com/mdp/qrterminal/v3"
@@ -8,6 +9,8 @@ import (
 	"gorm.io/gorm"
 	"log"
 	"time"
+	"wechat-assistant/admin"
+	"wechat-assistant/event"
 	"wechat-assistant/redirect"
 )
 
@@ -17,6 +20,7 @@ type Manager struct {
 	MsgHandler    *MsgHandler          `aware:""`
 	Redirect      redirect.MsgRedirect `aware:"omitempty"`
 	MessageSender *redirect.MsgSender  `aware:""`
+	AdminManager  *admin.Manager       `aware:""`
 	Resty         *resty.Client        `aware:"resty"`
 	DB            *gorm.DB             `aware:"db"`
 }
@@ -33,6 +37,11 @@ func (b *Manager) AfterPropertiesSet() {
 		log.Println(openwechat.GetQrcodeUrl(uuid))
 		qrterminal.Generate("https://login.weixin.qq.com/l/"+uuid, qrterminal.L, log.Writer())
 	}
+	// 注册退出登录回调
+	b.Bot.LogoutCallBack = func(*openwechat.Bot) {
+		log.Println("已退出登录")
+		b.MsgHandler.PluginManager.Publish(event.Event{Type: event.Logout})
+	}
 	// 注册消息处理器
 	b.Bot.MessageHandler = b.MsgHandler.GetHandler()
 	if b.Redirect != nil {
@@ -44,29 +53,32 @@ func (b *Manager) commandHandler(command redirect.BotCommand) {
 	switch command.Command {
 	case "sendMessage":
 		msg := command.Param
+		var err error
 		switch msg.Type {
 		case 1:
 			if msg.Gid != "" {
-				if _, err := b.MessageSender.SendGroupTextMsgByGid(msg.Gid, msg.Body); err != nil {
-					log.Println("发送消息失败", err)
-				}
+				_, err = b.MessageSender.SendGroupTextMsgByGid(msg.Gid, msg.Body)
 			} else if msg.GroupName != "" {
-				if _, err := b.MessageSender.SendGroupTextMsgByGroupName(msg.GroupName, msg.Body); err != nil {
-					log.Println("发送消息失败", err)
-				}
+				_, err = b.MessageSender.SendGroupTextMsgByGroupName(msg.GroupName, msg.Body)
 			}
 		case 2, 3, 4:
 			if msg.Gid != "" {
-				if _, err := b.MessageSender.SendGroupMediaMsgByGid(msg.Gid, msg.Type, msg.Body, msg.Filename, msg.Prompt); err != nil {
-					log.Println("发送消息失败", err)
-				}
+				_, err = b.MessageSender.SendGroupMediaMsgByGid(msg.Gid, msg.Type, msg.Body, msg.Filename, msg.Prompt)
 			} else if msg.GroupName != "" {
-				if _, err := b.MessageSender.SendGroupMediaMsgByGroupName(msg.GroupName, msg.Type, msg.Body, msg.Filename, msg.Prompt); err != nil {
-					log.Println("发送消息失败", err)
-				}
+				_, err = b.MessageSender.SendGroupMediaMsgByGroupName(msg.GroupName, msg.Type, msg.Body, msg.Filename, msg.Prompt)
 			}
-
 		}
+		if err != nil {
+			log.Println("发送消息失败", err)
+		}
+		b.AdminManager.Audit(admin.AuditLog{
+			Source:    admin.SourceMQTT,
+			GID:       msg.Gid,
+			GroupName: msg.GroupName,
+			Command:   command.Command,
+			Args:      fmt.Sprintf("type=%d body=%s", msg.Type, msg.Body),
+			Outcome:   admin.Outcome(err == nil, err),
+		})
 	}
 }
 
@@ -84,6 +96,7 @@ func (b *Manager) Initialized() {
 	if err != nil {
 		log.Fatalln("获取用户出错", err)
 	}
+	b.MsgHandler.PluginManager.Publish(event.Event{Type: event.Login})
 
 	// 获取所有的好友
 	friends, err := self.Friends()
@@ -118,6 +131,9 @@ func (b *Manager) updateGroup() ([]Group, []GroupUser) {
 
 		groupModel := new(Group)
 		b.DB.Take(groupModel, "g_id=?", group.UserName)
+		// 本次登录已记录过的群才检测新成员，避免登录后首次刷新时所有成员都被视为新成员
+		existed := groupModel.GID != ""
+		var joined []string
 		if groupModel == nil || groupModel.GID == "" {
 			groupModel = &Group{GID: group.UserName, GroupName: group.NickName, Time: time.Now().Unix()}
 			res := b.DB.Create(groupModel)
@@ -127,6 +143,12 @@ func (b *Manager) updateGroup() ([]Group, []GroupUser) {
 				modifyGroups = append(modifyGroups, *groupModel)
 			}
 		} else if groupModel.GroupName != group.NickName {
+			b.MsgHandler.PluginManager.Publish(event.Event{
+				Type:      event.GroupRenamed,
+				GID:       group.UserName,
+				GroupName: group.NickName,
+				OldName:   groupModel.GroupName,
+			})
 			groupModel.GroupName = group.NickName
 			groupModel.Time = time.Now().Unix()
 			res := b.DB.Model(Group{}).
@@ -159,11 +181,18 @@ func (b *Manager) updateGroup() ([]Group, []GroupUser) {
 					AttrStatus: member.AttrStatus,
 					Time:       time.Now().Unix(),
 				}
+				var count int64
+				if existed {
+					b.DB.Model(GroupUser{}).Where("g_id=? and wechat_name=?", groupModel.GID, member.NickName).Count(&count)
+				}
 				res := b.DB.Create(groupUser)
 				if res.Error != nil {
 					log.Println("更新群成员信息失败", groupUser.GID, groupUser.Username, groupUser.WechatName, err)
 				} else if res.RowsAffected > 0 {
 					modifyUsers = append(modifyUsers, groupUser)
+					if existed && count == 0 {
+						joined = append(joined, username)
+					}
 				}
 			} else if groupUser.Username != username || groupUser.WechatName != member.NickName {
 				groupUser.Username = username
@@ -192,6 +221,9 @@ func (b *Manager) updateGroup() ([]Group, []GroupUser) {
 					})
 			}
 		}
+		if len(joined) > 0 {
+			b.MsgHandler.memberJoined(group.UserName, group.NickName, joined)
+		}
 	}
 	return modifyGroups, modifyUsers
 }
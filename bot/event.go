@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"encoding/xml"
+	"github.com/eatmoreapple/openwechat"
+	"strings"
+	"time"
+	"wechat-assistant/event"
+)
+
+// ParseLeaveNames 从退群系统消息中解析成员名称
+func ParseLeaveNames(content string) []string {
+	// 你将"成员1、成员2"移出了群聊 或 "成员"退出了群聊
+	i := strings.Index(content, "移出了群聊")
+	if i < 0 {
+		i = strings.Index(content, "退出了群聊")
+	}
+	if i < 0 {
+		return nil
+	}
+	matches := joinNamePattern.FindAllStringSubmatch(content[:i], -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	return strings.Split(matches[len(matches)-1][1], "、")
+}
+
+// ParseGroupRename 从修改群名系统消息中解析新群名
+func ParseGroupRename(content string) (string, bool) {
+	// "成员"修改群名为"新群名"
+	i := strings.Index(content, "修改群名为")
+	if i < 0 {
+		return "", false
+	}
+	match := joinNamePattern.FindStringSubmatch(content[i:])
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// memberJoined 新成员入群时发送欢迎并通知订阅事件的插件
+func (h *MsgHandler) memberJoined(gid string, groupName string, names []string) {
+	if joined := h.WelcomeManager.Welcome(gid, groupName, names); len(joined) > 0 {
+		h.PluginManager.Publish(event.Event{Type: event.MemberJoined, GID: gid, GroupName: groupName, Names: joined})
+	}
+}
+
+// groupEvent 将退群、改名、撤回等群事件通知订阅事件的插件
+func (h *MsgHandler) groupEvent(ctx *openwechat.MessageContext) {
+	if !ctx.IsSystem() && !ctx.IsRecalled() {
+		return
+	}
+	group, err := ctx.Sender()
+	if err != nil {
+		return
+	}
+	if ctx.IsRecalled() {
+		h.messageRecalled(group, ctx.Content)
+		return
+	}
+	if names := ParseLeaveNames(ctx.Content); len(names) > 0 {
+		h.PluginManager.Publish(event.Event{Type: event.MemberLeft, GID: group.UserName, GroupName: group.NickName, Names: names})
+	} else if name, ok := ParseGroupRename(ctx.Content); ok {
+		h.groupRenamed(group.UserName, name)
+	}
+}
+
+// messageRecalled 通知消息撤回，消息内容从历史记录中查找
+func (h *MsgHandler) messageRecalled(group *openwechat.User, content string) {
+	var sysMsg SysMsg
+	if err := xml.Unmarshal([]byte(content), &sysMsg); err != nil {
+		return
+	}
+	e := event.Event{
+		Type:      event.MessageRecalled,
+		GID:       group.UserName,
+		GroupName: group.NickName,
+		MsgID:     sysMsg.RevokeMsg.MsgID,
+	}
+	history := new(MsgHistory)
+	if err := h.DB.Where("msg_id = ?", e.MsgID).Limit(1).Find(history).Error; err == nil && history.MsgID != "" {
+		e.UID = history.UID
+		e.Username = history.Username
+		e.Content = history.Message
+	}
+	h.PluginManager.Publish(e)
+}
+
+// groupRenamed 记录新群名并通知群改名，定时刷新群信息时不再重复通知
+func (h *MsgHandler) groupRenamed(gid string, name string) {
+	groupModel := new(Group)
+	h.DB.Take(groupModel, "g_id = ?", gid)
+	if groupModel.GroupName == name {
+		return
+	}
+	h.DB.Model(&Group{}).Where("g_id = ?", gid).Updates(map[string]interface{}{
+		"group_name": name,
+		"`time`":     time.Now().Unix(),
+	})
+	h.PluginManager.Publish(event.Event{Type: event.GroupRenamed, GID: gid, GroupName: name, OldName: groupModel.GroupName})
+}
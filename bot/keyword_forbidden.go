@@ -6,27 +6,181 @@ import (
 	"github.com/eatmoreapple/openwechat"
 	"gorm.io/gorm"
 	"log"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
-	"wechat-assistant/util/totp"
+	"wechat-assistant/admin"
+)
+
+const (
+	RuleTypeGroup  = 1 // 群内禁用
+	RuleTypeUser   = 2 // 群内指定用户禁用
+	RuleTypeGlobal = 3 // 全局禁用
+	RuleTypeAllow  = 4 // 群白名单，存在白名单时仅允许名单内的关键词
+
+	MatchExact  = 0 // 完全匹配
+	MatchPrefix = 1 // 前缀匹配
+	MatchRegex  = 2 // 正则匹配
 )
 
 type KeywordForbidden struct {
-	ID       uint   `gorm:"primaryKey;autoIncrement"`
-	Keyword  string `gorm:"type:varchar(255)"` // 关键词
-	RuleType int    `gorm:"type:int(2)"`       // 规则类型,1:群
-	Setting  string `gorm:"type:varchar(255)"` // 规则设置
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	Keyword   string `gorm:"type:varchar(255)"` // 关键词
+	RuleType  int    `gorm:"type:int(2)"`       // 规则类型,1:群,2:用户,3:全局,4:白名单
+	Setting   string `gorm:"type:varchar(255)"` // 规则设置,群id或群名称
+	User      string `gorm:"type:varchar(255)"` // 用户昵称,规则类型为2时有效
+	MatchType int    `gorm:"type:int(2)"`       // 匹配方式,0:完全,1:前缀,2:正则
+	Weekdays  string `gorm:"type:varchar(20)"`  // 生效星期,如1-5,空表示每天
+	TimeRange string `gorm:"type:varchar(20)"`  // 生效时段,如09:00-18:00,空表示全天
+}
+
+func (k KeywordForbidden) String() string {
+	msg := fmt.Sprintf("%d:[%s]", k.ID, k.Keyword)
+	switch k.MatchType {
+	case MatchPrefix:
+		msg += "前缀"
+	case MatchRegex:
+		msg += "正则"
+	}
+	switch k.RuleType {
+	case RuleTypeGroup:
+		msg += " 群禁用"
+	case RuleTypeUser:
+		msg += " 禁用用户:" + k.User
+	case RuleTypeGlobal:
+		msg += " 全局禁用"
+	case RuleTypeAllow:
+		msg += " 白名单"
+	}
+	if k.Weekdays != "" {
+		msg += " 星期" + k.Weekdays
+	}
+	if k.TimeRange != "" {
+		msg += " " + k.TimeRange
+	}
+	return msg
+}
+
+// matchKeyword 判断关键词是否匹配规则
+func (k KeywordForbidden) matchKeyword(keyword string, regexCache *sync.Map) bool {
+	switch k.MatchType {
+	case MatchPrefix:
+		return strings.HasPrefix(keyword, k.Keyword)
+	case MatchRegex:
+		var re *regexp.Regexp
+		if v, ok := regexCache.Load(k.Keyword); ok {
+			re = v.(*regexp.Regexp)
+		} else {
+			compiled, err := regexp.Compile(k.Keyword)
+			if err != nil {
+				return false
+			}
+			regexCache.Store(k.Keyword, compiled)
+			re = compiled
+		}
+		return re.MatchString(keyword)
+	default:
+		return k.Keyword == keyword
+	}
+}
+
+// sameRule 判断是否为同一条规则，非全局规则按群名称和群id各记录一行
+func (k KeywordForbidden) sameRule(o KeywordForbidden) bool {
+	return k.Keyword == o.Keyword && k.RuleType == o.RuleType && k.User == o.User &&
+		k.MatchType == o.MatchType && k.Weekdays == o.Weekdays && k.TimeRange == o.TimeRange
+}
+
+// matchGroup 判断群是否在规则范围内
+func (k KeywordForbidden) matchGroup(group *openwechat.User) bool {
+	return strings.EqualFold(k.Setting, group.NickName) || strings.EqualFold(k.Setting, group.UserName)
+}
+
+// active 判断规则在指定时间是否生效
+func (k KeywordForbidden) active(now time.Time) bool {
+	if k.Weekdays != "" && !matchWeekday(k.Weekdays, now.Weekday()) {
+		return false
+	}
+	if k.TimeRange != "" && !matchTimeRange(k.TimeRange, now) {
+		return false
+	}
+	return true
+}
+
+// matchWeekday 匹配星期设置，支持1-5或1,3,5格式，0和7均表示周日
+func matchWeekday(setting string, weekday time.Weekday) bool {
+	day := int(weekday)
+	for _, part := range strings.Split(setting, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			continue
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(bounds[1]); err != nil {
+				continue
+			}
+		}
+		for d := start; d <= end; d++ {
+			if d%7 == day {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchTimeRange 匹配时段设置，支持跨天，如22:00-06:00
+func matchTimeRange(setting string, now time.Time) bool {
+	bounds := strings.SplitN(setting, "-", 2)
+	if len(bounds) != 2 {
+		return false
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(bounds[1]))
+	if err != nil {
+		return false
+	}
+	current := now.Hour()*60 + now.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	if from <= to {
+		return current >= from && current < to
+	}
+	return current >= from || current < to
 }
 
 type KeywordForbiddenManager struct {
-	Secret string   `value:"bot.secret"`
-	DB     *gorm.DB `aware:"db"`
+	Admin      *admin.Manager `aware:""`
+	DB         *gorm.DB       `aware:"db"`
+	regexCache sync.Map
+	mutex      sync.RWMutex
+	rules      []KeywordForbidden // 全部规则，修改后重新加载
 }
 
 func (m *KeywordForbiddenManager) AfterPropertiesSet() {
 	if err := m.DB.AutoMigrate(&KeywordForbidden{}); err != nil {
 		log.Fatalln("初始化关键词黑名单出错", err)
 	}
+	if err := m.reload(); err != nil {
+		log.Fatalln("加载关键词黑名单出错", err)
+	}
+}
+
+func (m *KeywordForbiddenManager) reload() error {
+	var rules []KeywordForbidden
+	if err := m.DB.Order("id").Find(&rules).Error; err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	m.rules = rules
+	m.mutex.Unlock()
+	return nil
 }
 
 func (m *KeywordForbiddenManager) HandleManage(content string, ctx *openwechat.MessageContext) (ok bool, err error) {
@@ -34,8 +188,7 @@ func (m *KeywordForbiddenManager) HandleManage(content string, ctx *openwechat.M
 	if len(subCommands) < 2 {
 		return
 	}
-	if subCommands[0] != "000000" && !totp.TOTPVerify(m.Secret, 30, subCommands[0]) {
-		log.Println("验证失败", time.Now().Format(time.DateTime), subCommands[0])
+	if !m.Admin.Verify(ctx, subCommands[0]) {
 		return
 	}
 	defer func() {
@@ -58,13 +211,18 @@ func (m *KeywordForbiddenManager) HandleManage(content string, ctx *openwechat.M
 	commands := subCommands[1:]
 	switch commands[0] {
 	case "add":
+		// add 关键词 [prefix|regex] [global] [user=昵称] [days=1-5] [time=09:00-18:00]
 		if len(commands) == 1 {
 			return false, errors.New("命令格式错误:请输入关键词")
 		}
-		if err := m.AddForbiddenByGroup(commands[1], sender.UserName, sender.NickName); err != nil {
+		rule, err := parseRule(commands[1])
+		if err != nil {
+			return false, err
+		}
+		if err := m.AddRule(rule, sender.UserName, sender.NickName); err != nil {
 			return false, errors.New("操作出错:" + err.Error())
 		}
-		_, _ = ctx.ReplyText(fmt.Sprintf("当前群已禁用关键词:%s", commands[1]))
+		_, _ = ctx.ReplyText(fmt.Sprintf("已添加禁用规则:%s", rule.String()))
 		return true, nil
 	case "del":
 		if len(commands) == 1 {
@@ -75,45 +233,214 @@ func (m *KeywordForbiddenManager) HandleManage(content string, ctx *openwechat.M
 		}
 		_, _ = ctx.ReplyText(fmt.Sprintf("当前群已解除关键词:%s 禁用", commands[1]))
 		return true, nil
+	case "rm":
+		if len(commands) == 1 {
+			return false, errors.New("命令格式错误:请输入规则ID")
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(commands[1]))
+		if err != nil {
+			return false, errors.New("命令格式错误:规则ID必须为数字")
+		}
+		removed, err := m.RemoveRule(uint(id), sender.UserName, sender.NickName)
+		if err != nil {
+			return false, errors.New("操作出错:" + err.Error())
+		}
+		if removed {
+			_, _ = ctx.ReplyText("已删除规则")
+		} else {
+			_, _ = ctx.ReplyText("未找到规则")
+		}
+		return true, nil
+	case "allow":
+		if len(commands) == 1 {
+			return false, errors.New("命令格式错误:请输入关键词")
+		}
+		for _, keyword := range strings.Fields(commands[1]) {
+			rule := KeywordForbidden{Keyword: keyword, RuleType: RuleTypeAllow}
+			if err := m.AddRule(rule, sender.UserName, sender.NickName); err != nil {
+				return false, errors.New("操作出错:" + err.Error())
+			}
+		}
+		_, _ = ctx.ReplyText(fmt.Sprintf("当前群已加入白名单:%s", commands[1]))
+		return true, nil
+	case "disallow":
+		if len(commands) == 1 {
+			return false, errors.New("命令格式错误:请输入关键词")
+		}
+		err := m.DB.Where("keyword = ? and rule_type = ? and (setting = ? or setting = ?)", commands[1], RuleTypeAllow, sender.UserName, sender.NickName).
+			Delete(&KeywordForbidden{}).Error
+		_ = m.reload()
+		if err != nil {
+			return false, errors.New("操作出错:" + err.Error())
+		}
+		_, _ = ctx.ReplyText(fmt.Sprintf("当前群已移出白名单:%s", commands[1]))
+		return true, nil
+	case "list":
+		rules, err := m.ListRules(sender.UserName, sender.NickName)
+		if err != nil {
+			return false, errors.New("查询禁用规则出错")
+		}
+		if len(rules) == 0 {
+			_, _ = ctx.ReplyText("当前群没有禁用规则")
+			return true, nil
+		}
+		msg := "当前群的禁用规则如下:\n"
+		for _, rule := range rules {
+			msg += rule.String() + "\n"
+		}
+		_, _ = ctx.ReplyText(msg)
+		return true, nil
 	}
 	return false, nil
 }
 
+// parseRule 解析规则参数
+func parseRule(content string) (KeywordForbidden, error) {
+	params := strings.Fields(content)
+	rule := KeywordForbidden{Keyword: params[0], RuleType: RuleTypeGroup}
+	for _, param := range params[1:] {
+		switch {
+		case param == "prefix":
+			rule.MatchType = MatchPrefix
+		case param == "regex":
+			if _, err := regexp.Compile(rule.Keyword); err != nil {
+				return rule, errors.New("正则表达式错误:" + err.Error())
+			}
+			rule.MatchType = MatchRegex
+		case param == "global":
+			rule.RuleType = RuleTypeGlobal
+		case strings.HasPrefix(param, "user="):
+			rule.RuleType = RuleTypeUser
+			rule.User = strings.TrimPrefix(strings.TrimPrefix(param, "user="), "@")
+		case strings.HasPrefix(param, "days="):
+			rule.Weekdays = strings.TrimPrefix(param, "days=")
+		case strings.HasPrefix(param, "time="):
+			rule.TimeRange = strings.TrimPrefix(param, "time=")
+			if !strings.Contains(rule.TimeRange, "-") {
+				return rule, errors.New("时段格式错误,示例:09:00-18:00")
+			}
+		default:
+			return rule, errors.New("未知参数:" + param)
+		}
+	}
+	return rule, nil
+}
+
 func (m *KeywordForbiddenManager) RemoveForbiddenByGroup(keyword string, gid string, groupName string) error {
-	return m.DB.Where("keyword = ? and (setting = ? or setting = ?)", keyword, gid, groupName).Delete(&KeywordForbidden{}).Error
+	defer m.reload()
+	return m.DB.Where("keyword = ? and rule_type <> ? and (setting = ? or setting = ?)", keyword, RuleTypeAllow, gid, groupName).Delete(&KeywordForbidden{}).Error
+}
+
+// RemoveRule 删除规则，规则属于当前群时同时删除按群名称和群id记录的两行
+func (m *KeywordForbiddenManager) RemoveRule(id uint, gid string, groupName string) (bool, error) {
+	rule := new(KeywordForbidden)
+	if err := m.DB.Limit(1).Find(rule, "id = ?", id).Error; err != nil {
+		return false, err
+	} else if rule.ID == 0 {
+		return false, nil
+	}
+	defer m.reload()
+	if rule.RuleType == RuleTypeGlobal {
+		return true, m.DB.Delete(rule).Error
+	}
+	settings := []string{rule.Setting}
+	if rule.matchGroup(&openwechat.User{UserName: gid, NickName: groupName}) {
+		settings = append(settings, gid, groupName)
+	}
+	return true, m.DB.Where("keyword = ? and rule_type = ? and `user` = ? and match_type = ? and weekdays = ? and time_range = ?",
+		rule.Keyword, rule.RuleType, rule.User, rule.MatchType, rule.Weekdays, rule.TimeRange).
+		Where("setting in ?", settings).
+		Delete(&KeywordForbidden{}).Error
 }
 
 func (m *KeywordForbiddenManager) AddForbiddenByGroup(keyword string, gid string, groupName string) error {
-	rules := []KeywordForbidden{
-		{Keyword: keyword, RuleType: 1, Setting: groupName},
-		{Keyword: keyword, RuleType: 1, Setting: gid},
+	return m.AddRule(KeywordForbidden{Keyword: keyword, RuleType: RuleTypeGroup}, gid, groupName)
+}
+
+// AddRule 添加规则，全局规则之外的规则同时按群名称和群id记录
+func (m *KeywordForbiddenManager) AddRule(rule KeywordForbidden, gid string, groupName string) error {
+	defer m.reload()
+	if rule.RuleType == RuleTypeGlobal {
+		return m.DB.Create(&rule).Error
 	}
+	byName, byId := rule, rule
+	byName.Setting = groupName
+	byId.Setting = gid
+	rules := []KeywordForbidden{byName, byId}
 	return m.DB.Create(&rules).Error
 }
 
-func (m *KeywordForbiddenManager) CheckKeyword(ctx *openwechat.MessageContext, keyword string) (bool, error) {
-	rules := new([]KeywordForbidden)
-	if err := m.DB.Find(&rules, "keyword = ?", keyword).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return true, nil
+// ListRules 查询对群生效的规则，gid和groupName均为空时返回全部规则
+func (m *KeywordForbiddenManager) ListRules(gid string, groupName string) ([]KeywordForbidden, error) {
+	var rules []KeywordForbidden
+	tx := m.DB.Model(&KeywordForbidden{})
+	if gid != "" || groupName != "" {
+		tx = tx.Where("rule_type = ? or setting = ? or setting = ?", RuleTypeGlobal, gid, groupName)
+	}
+	if err := tx.Order("id").Find(&rules).Error; err != nil || (gid == "" && groupName == "") {
+		return rules, err
+	}
+	// 同一条规则按群名称和群id记录了两行，只保留一行
+	distinct := make([]KeywordForbidden, 0, len(rules))
+	for _, rule := range rules {
+		duplicated := false
+		for _, v := range distinct {
+			if v.sameRule(rule) {
+				duplicated = true
+				break
+			}
 		}
-		return false, err
-	} else if rules == nil || len(*rules) == 0 {
+		if !duplicated {
+			distinct = append(distinct, rule)
+		}
+	}
+	return distinct, nil
+}
+
+func (m *KeywordForbiddenManager) CheckKeyword(ctx *openwechat.MessageContext, keyword string) (bool, error) {
+	m.mutex.RLock()
+	rules := m.rules
+	m.mutex.RUnlock()
+	if len(rules) == 0 {
 		return true, nil
-	} else {
-		sender, err := ctx.Sender()
-		if err != nil {
-			return false, err
+	}
+	sender, err := ctx.Sender()
+	if err != nil {
+		return false, err
+	}
+	var user *openwechat.User
+	now := time.Now()
+	allowList, allowed := false, false
+	for _, v := range rules {
+		if !v.active(now) {
+			continue
 		}
-		for _, v := range *rules {
-			if v.RuleType == 1 { // 群匹配
-				if strings.EqualFold(v.Setting, sender.NickName) {
-					return false, nil
-				} else if strings.EqualFold(v.Setting, sender.UserName) {
+		switch v.RuleType {
+		case RuleTypeGroup: // 群匹配
+			if v.matchGroup(sender) && v.matchKeyword(keyword, &m.regexCache) {
+				return false, nil
+			}
+		case RuleTypeUser: // 用户匹配
+			if v.matchGroup(sender) && v.matchKeyword(keyword, &m.regexCache) {
+				if user == nil {
+					if user, err = ctx.SenderInGroup(); err != nil {
+						return false, err
+					}
+				}
+				if v.User == user.NickName || v.User == user.DisplayName {
 					return false, nil
 				}
 			}
+		case RuleTypeGlobal: // 全局匹配
+			if v.matchKeyword(keyword, &m.regexCache) {
+				return false, nil
+			}
+		case RuleTypeAllow: // 白名单
+			if v.matchGroup(sender) {
+				allowList = true
+				allowed = allowed || v.matchKeyword(keyword, &m.regexCache)
+			}
 		}
-		return true, nil
 	}
+	return !allowList || allowed, nil
 }
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := parseRule("天气 prefix user=@张三 days=1-5 time=09:00-18:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := KeywordForbidden{Keyword: "天气", RuleType: RuleTypeUser, User: "张三", MatchType: MatchPrefix, Weekdays: "1-5", TimeRange: "09:00-18:00"}
+	if rule != want {
+		t.Fatalf("期望%v, 实际%v", want, rule)
+	}
+	if rule, err := parseRule("天气 global"); err != nil || rule.RuleType != RuleTypeGlobal {
+		t.Fatalf("期望全局规则, 实际%v %v", rule, err)
+	}
+	for _, content := range []string{"天气 unknown", "天气 time=0900", "[ regex"} {
+		if _, err := parseRule(content); err == nil {
+			t.Errorf("%s: 期望返回错误", content)
+		}
+	}
+}
+
+func TestMatchWeekday(t *testing.T) {
+	cases := []struct {
+		setting string
+		weekday time.Weekday
+		want    bool
+	}{
+		{"1-5", time.Monday, true},
+		{"1-5", time.Saturday, false},
+		{"1,3,5", time.Wednesday, true},
+		{"1,3,5", time.Tuesday, false},
+		{"7", time.Sunday, true},
+		{"0", time.Sunday, true},
+		{"6-7", time.Sunday, true},
+		{"x", time.Monday, false},
+	}
+	for _, c := range cases {
+		if got := matchWeekday(c.setting, c.weekday); got != c.want {
+			t.Errorf("%s %s: 期望%v, 实际%v", c.setting, c.weekday, c.want, got)
+		}
+	}
+}
+
+func TestMatchTimeRange(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+	cases := []struct {
+		setting string
+		now     time.Time
+		want    bool
+	}{
+		{"09:00-18:00", at(9, 0), true},
+		{"09:00-18:00", at(17, 59), true},
+		{"09:00-18:00", at(18, 0), false},
+		{"09:00-18:00", at(8, 59), false},
+		{"22:00-06:00", at(23, 30), true},
+		{"22:00-06:00", at(5, 0), true},
+		{"22:00-06:00", at(12, 0), false},
+		{"0900-1800", at(12, 0), false},
+	}
+	for _, c := range cases {
+		if got := matchTimeRange(c.setting, c.now); got != c.want {
+			t.Errorf("%s %s: 期望%v, 实际%v", c.setting, c.now.Format("15:04"), c.want, got)
+		}
+	}
+}
+
+func TestRemoveRule(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &KeywordForbiddenManager{DB: db}
+	if err := db.AutoMigrate(&KeywordForbidden{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddRule(KeywordForbidden{Keyword: "天气", RuleType: RuleTypeGroup}, "@@group", "测试群"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddRule(KeywordForbidden{Keyword: "天气", RuleType: RuleTypeGroup}, "@@other", "其他群"); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.rules) != 4 {
+		t.Fatalf("期望缓存4行规则, 实际%d", len(m.rules))
+	}
+	rules, err := m.ListRules("@@group", "测试群")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("同一规则只应显示一次, 实际%v", rules)
+	}
+	if removed, err := m.RemoveRule(rules[0].ID, "@@group", "测试群"); err != nil || !removed {
+		t.Fatalf("删除规则失败 %v %v", removed, err)
+	}
+	if rules, _ := m.ListRules("@@group", "测试群"); len(rules) != 0 {
+		t.Fatalf("按群名称和群id记录的规则应一并删除, 剩余%v", rules)
+	}
+	if rules, _ := m.ListRules("@@other", "其他群"); len(rules) != 1 {
+		t.Fatalf("不应删除其他群的规则, 剩余%v", rules)
+	}
+	if len(m.rules) != 2 {
+		t.Fatalf("删除后应重新加载规则, 实际%d", len(m.rules))
+	}
+	if removed, _ := m.RemoveRule(100, "@@group", "测试群"); removed {
+		t.Fatal("不存在的规则不应删除")
+	}
+}
@@ -0,0 +1,59 @@
+package bot
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"strings"
+)
+
+// MentionKey 消息中@的群成员id列表
+const MentionKey = "mentions"
+
+// ExtractMentions 提取消息中@的群成员id，同名时优先匹配最长的名称，结果按出现顺序去重
+func ExtractMentions(content string, members openwechat.Members) []string {
+	if !strings.Contains(content, "@") || len(members) == 0 {
+		return nil
+	}
+	// 群昵称、备注和微信昵称均可能作为@的名称
+	names := map[string]string{}
+	for _, member := range members {
+		for _, name := range []string{member.NickName, member.RemarkName, member.DisplayName} {
+			if name == "" {
+				continue
+			}
+			name = openwechat.FormatEmoji(name)
+			if _, exist := names[name]; !exist {
+				names[name] = member.UserName
+			}
+		}
+	}
+	var uids []string
+	seen := map[string]bool{}
+	for i := 0; i < len(content); {
+		at := strings.Index(content[i:], "@")
+		if at < 0 {
+			break
+		}
+		start := i + at + 1
+		matched := ""
+		for name := range names {
+			if len(name) <= len(matched) || !strings.HasPrefix(content[start:], name) {
+				continue
+			}
+			// 名称之后必须为分隔符或结尾
+			rest := content[start+len(name):]
+			if rest == "" || strings.HasPrefix(rest, "\u2005") || strings.HasPrefix(rest, " ") || strings.HasPrefix(rest, "\n") {
+				matched = name
+			}
+		}
+		if matched == "" {
+			i = start
+			continue
+		}
+		if uid := names[matched]; !seen[uid] {
+			seen[uid] = true
+			uids = append(uids, uid)
+		}
+		i = start + len(matched)
+	}
+	return uids
+}
@@ -0,0 +1,40 @@
+package bot
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"reflect"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	members := openwechat.Members{
+		{UserName: "@zhang", NickName: "张三", DisplayName: "老张"},
+		{UserName: "@zhangsanfeng", NickName: "张三丰"},
+		{UserName: "@li", NickName: "李四", RemarkName: "小李"},
+	}
+	cases := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"昵称", "@张三 开会了", []string{"@zhang"}},
+		{"群昵称", "@老张 开会了", []string{"@zhang"}},
+		{"备注", "@小李 你好", []string{"@li"}},
+		{"最长匹配", "@张三丰 你好", []string{"@zhangsanfeng"}},
+		{"多人按出现顺序", "@李四 @张三 开会", []string{"@li", "@zhang"}},
+		{"去重", "@张三 @老张 开会", []string{"@zhang"}},
+		{"结尾", "开会了@李四", []string{"@li"}},
+		{"名称后缺少分隔符", "@张三开会了", nil},
+		{"非成员", "@王五 开会了", nil},
+		{"邮箱", "发到test@example.com", nil},
+		{"没有@", "开会了", nil},
+	}
+	for _, c := range cases {
+		if got := ExtractMentions(c.content, members); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: 期望%v, 实际%v", c.name, c.want, got)
+		}
+	}
+	if got := ExtractMentions("@张三 开会了", nil); got != nil {
+		t.Errorf("没有群成员时期望nil, 实际%v", got)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"github.com/eatmoreapple/openwechat"
-	"golang.org/x/time/rate"
 	"gorm.io/gorm"
 	"log"
 	"net/http"
@@ -15,47 +14,55 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+	"wechat-assistant/admin"
 	"wechat-assistant/plugin"
 	"wechat-assistant/redirect"
-	"wechat-assistant/util/limiter"
-	"wechat-assistant/util/totp"
+	"wechat-assistant/util/workpool"
 )
 
 type (
 	MsgHistory struct {
-		ID         uint   `gorm:"primaryKey;autoIncrement"`
-		GID        string `gorm:"type:varchar(255)"`
-		UID        string `gorm:"type:varchar(255)"`
-		AttrStatus int64  `gorm:"type:int(20)"`
-		MsgType    int    `gorm:"type:int(2)"`
-		GroupName  string `gorm:"type:varchar(255)"`
-		Username   string `gorm:"type:varchar(255)"`
-		WechatName string `gorm:"type:varchar(255)"`
-		Message    string ``
-		Time       int64  `gorm:"type:int(20)"`
-		MsgID      string `gorm:"type:varchar(50)"`
+		ID         uint              `gorm:"primaryKey;autoIncrement"`
+		GID        string            `gorm:"type:varchar(255)"`
+		UID        string            `gorm:"type:varchar(255)"`
+		AttrStatus int64             `gorm:"type:int(20)"`
+		MsgType    int               `gorm:"type:int(2)"`
+		GroupName  string            `gorm:"type:varchar(255)"`
+		Username   string            `gorm:"type:varchar(255)"`
+		WechatName string            `gorm:"type:varchar(255)"`
+		Message    string            ``
+		Time       int64             `gorm:"type:int(20)"`
+		MsgID      string            `gorm:"type:varchar(50)"`
+		QuoteMsgID string            `gorm:"type:varchar(50)"`          // 引用的消息id
+		Payload    *redirect.Payload `gorm:"serializer:json;type:text"` // 链接、小程序、文件、名片、位置等消息的结构化内容
+		Mentions   []string          `gorm:"serializer:json;type:text"` // @的群成员id
 	}
 )
 
 type MsgHandler struct {
-	Secret                  string                   `value:"bot.secret"`
 	FilesPath               string                   `value:"bot.files"`
+	Workers                 int                      `value:"bot.workers"`
+	QueueSize               int                      `value:"bot.queue"`
+	GroupQueueSize          int                      `value:"bot.groupQueue"`
 	DB                      *gorm.DB                 `aware:"db"`
+	AdminManager            *admin.Manager           `aware:""`
 	PluginManager           *plugin.Manager          `aware:""`
 	KeywordForbiddenManager *KeywordForbiddenManager `aware:""`
 	MsgRedirect             redirect.MsgRedirect     `aware:"omitempty"`
+	QuotaManager            *QuotaManager            `aware:""`
+	ModerationManager       *ModerationManager       `aware:""`
+	AutoReplyManager        *AutoReplyManager        `aware:""`
+	ScheduleManager         *ScheduleManager         `aware:""`
+	ReminderManager         *ReminderManager         `aware:""`
+	WelcomeManager          *WelcomeManager          `aware:""`
 	Uploader                *redirect.S3Uploader     `aware:"omitempty"`
-	limit                   *limiter.Limiter
+	pool                    *workpool.Pool
 }
 
 func (h *MsgHandler) BeanName() string {
 	return "msgHandler"
 }
 
-func (h *MsgHandler) BeanConstruct() {
-	h.limit = limiter.NewLimiter(rate.Every(1*time.Second), 2)
-}
-
 func (h *MsgHandler) AfterPropertiesSet() {
 	if err := os.MkdirAll(h.FilesPath, os.ModePerm); err != nil {
 		log.Fatalln("创建缓存目录失败", err)
@@ -63,24 +70,92 @@ func (h *MsgHandler) AfterPropertiesSet() {
 	if err := h.DB.AutoMigrate(MsgHistory{}); err != nil {
 		log.Fatalln("初始化消息记录表出错", err)
 	}
-	if _, err := totp.TOTPToken(h.Secret, time.Now().Unix()); err != nil {
-		log.Fatalln("初始化动态密码生成器出错", err)
-	}
+	h.pool = workpool.New(h.Workers, h.QueueSize, h.GroupQueueSize)
+}
+
+func (h *MsgHandler) Destroy() {
+	h.pool.Close()
+}
+
+// QueueStats 消息处理队列指标
+func (h *MsgHandler) QueueStats() workpool.Stats {
+	return h.pool.Stats()
 }
 
 func (h *MsgHandler) GetHandler() openwechat.MessageHandler {
 	dispatcher := openwechat.NewMessageMatchDispatcher()
-	// 开启异步消息处理
-	dispatcher.SetAsync(true)
 	dispatcher.OnGroup(h.checkDuplicate)
+	dispatcher.OnGroup(h.welcome)
+	dispatcher.OnGroup(h.groupEvent)
 	dispatcher.OnGroup(h.preParseContent)
+	dispatcher.OnGroup(h.parsePayload)
+	dispatcher.OnGroup(h.parseMentions)
 	dispatcher.OnGroup(h.saveMedia)
+	// 违规消息不转发也不记录
+	dispatcher.OnGroup(h.moderate)
 	if h.MsgRedirect != nil {
 		dispatcher.OnGroup(h.redirectMsg)
 	}
 	dispatcher.OnGroup(h.RecordMsgHandler)
+	dispatcher.OnGroup(h.sessionHandler)
+	dispatcher.OnGroup(h.hookHandler)
 	dispatcher.OnGroup(h.CommandHandler)
-	return dispatcher.AsMessageHandler()
+	dispatcher.OnGroup(h.autoReply)
+	dispatcher.OnFriend(h.privateCommand)
+	handler := dispatcher.AsMessageHandler()
+	// 同一个群的消息按顺序处理，不同群之间由协程池并发处理，队列或群的排队数已满时丢弃消息，避免阻塞消息接收
+	return func(msg *openwechat.Message) {
+		key := msg.FromUserName
+		if msg.IsSendBySelf() {
+			key = msg.ToUserName
+		}
+		if !h.pool.TrySubmit(key, func() { handler(msg) }) {
+			log.Println("消息队列已满，丢弃消息", key, msg.MsgId)
+		}
+	}
+}
+
+// parsePayload 解析结构化消息内容，需在保存文件改写消息内容前执行
+func (h *MsgHandler) parsePayload(ctx *openwechat.MessageContext) {
+	if ctx.IsSystem() {
+		return
+	}
+	if payload := ParsePayload(ctx.Message); payload != nil {
+		ctx.Set(PayloadKey, payload)
+	}
+}
+
+// parseMentions 解析文本消息中@的群成员
+func (h *MsgHandler) parseMentions(ctx *openwechat.MessageContext) {
+	if ctx.IsSystem() || !ctx.IsText() {
+		return
+	}
+	sender, err := ctx.Sender()
+	if err != nil {
+		return
+	}
+	group, _ := sender.AsGroup()
+	if ctx.IsSendBySelf() {
+		groups, _ := ctx.Owner().Groups()
+		group = groups.SearchByUserName(1, ctx.ToUserName).First()
+	}
+	if group == nil {
+		return
+	}
+	content := ctx.Content
+	if quote, exist := ctx.Get(QuoteKey); exist {
+		content = quote.(*QuoteMessageInfo).Content
+	}
+	if !strings.Contains(content, "@") {
+		return
+	}
+	members, err := group.Members()
+	if err != nil {
+		return
+	}
+	if mentions := ExtractMentions(content, members); len(mentions) > 0 {
+		ctx.Set(MentionKey, mentions)
+	}
 }
 
 func (h *MsgHandler) saveMedia(msg *openwechat.MessageContext) {
@@ -184,18 +259,26 @@ func (h *MsgHandler) redirectMsg(ctx *openwechat.MessageContext) {
 		Username:   username,
 		GID:        group.UserName,
 		GroupName:  group.NickName,
-		RawMessage: strings.TrimSpace(ctx.Content),
+		RawMessage: redactConfigCommand(strings.TrimSpace(ctx.Content)),
 		MsgType:    int(ctx.MsgType),
 		Time:       ctx.CreateTime,
 	}
 	if quote, exist := ctx.Get(QuoteKey); exist {
 		q := quote.(*QuoteMessageInfo)
-		msg.RawMessage = q.Content
+		msg.RawMessage = redactConfigCommand(q.Content)
 		msg.Quote = &redirect.Quote{
-			Quote: q.Quote,
-			UID:   q.User.UserName,
+			Quote:   q.Quote,
+			UID:     q.UID,
+			MsgID:   q.MsgID,
+			MsgType: q.MsgType,
 		}
 	}
+	if payload, exist := ctx.Get(PayloadKey); exist {
+		msg.Payload = payload.(*redirect.Payload)
+	}
+	if mentions, exist := ctx.Get(MentionKey); exist {
+		msg.Mentions = mentions.([]string)
+	}
 	if ctx.IsRecalled() {
 		var revokeMsg SysMsg
 		err := xml.Unmarshal([]byte(ctx.Content), &revokeMsg)
@@ -232,7 +315,7 @@ func (h *MsgHandler) RecordMsgHandler(ctx *openwechat.MessageContext) {
 	if user.DisplayName == "" {
 		username = user.NickName
 	}
-	content := strings.TrimSpace(msg.Content)
+	content := redactConfigCommand(strings.TrimSpace(msg.Content))
 	record := &MsgHistory{
 		GID:        group.UserName,
 		UID:        user.UserName,
@@ -245,6 +328,15 @@ func (h *MsgHandler) RecordMsgHandler(ctx *openwechat.MessageContext) {
 		Time:       msg.CreateTime,
 		MsgID:      msg.MsgId,
 	}
+	if quote, exist := ctx.Get(QuoteKey); exist {
+		record.QuoteMsgID = quote.(*QuoteMessageInfo).MsgID
+	}
+	if payload, exist := ctx.Get(PayloadKey); exist {
+		record.Payload = payload.(*redirect.Payload)
+	}
+	if mentions, exist := ctx.Get(MentionKey); exist {
+		record.Mentions = mentions.([]string)
+	}
 	if err = h.DB.Save(record).Error; err != nil {
 		if !errors.Is(err, gorm.ErrDuplicatedKey) {
 			log.Println("记录消息出错", err)
@@ -252,31 +344,128 @@ func (h *MsgHandler) RecordMsgHandler(ctx *openwechat.MessageContext) {
 	}
 }
 
+// privateCommand 私聊指令，仅用于设置插件密钥等不宜在群内发送的配置
+func (h *MsgHandler) privateCommand(ctx *openwechat.MessageContext) {
+	if ctx.IsSendBySelf() || !ctx.IsText() {
+		return
+	}
+	// #插件 动态密码 config 插件ID 配置项 值
+	content := strings.TrimSpace(strings.TrimPrefix(ctx.Content, "#插件 "))
+	if content == strings.TrimSpace(ctx.Content) {
+		return
+	}
+	parts := strings.Fields(content)
+	if len(parts) < 2 || parts[1] != "config" {
+		return
+	}
+	ok, err := h.PluginManager.HandleManage(content, ctx)
+	if err != nil {
+		_, _ = ctx.ReplyText(err.Error())
+	}
+	h.AdminManager.AuditChat(ctx, "插件", redactPluginConfig(content), ok, err)
+}
+
+// redactPluginConfig 审计记录中隐藏插件配置的值
+func redactPluginConfig(content string) string {
+	parts := strings.Fields(content)
+	if len(parts) > 4 && parts[1] == "config" {
+		return strings.Join(append(parts[:4], "******"), " ")
+	}
+	return content
+}
+
+// redactConfigCommand 记录和转发的群消息中隐藏插件配置命令的配置值，避免密钥在群内发送时被保存
+func redactConfigCommand(content string) string {
+	parts := strings.Fields(content)
+	for i, part := range parts {
+		if strings.TrimPrefix(part, "#") == "插件" && len(parts) > i+4 && parts[i+2] == "config" {
+			return strings.Join(append(parts[:i+1], redactPluginConfig(strings.Join(parts[i+1:], " "))), " ")
+		}
+	}
+	return content
+}
+
 func (h *MsgHandler) dealCommand(ctx *openwechat.MessageContext, command string, content string) {
 	var ok bool
 	var err error
+	// 限流
+	if !h.QuotaManager.Allow(ctx, command) {
+		ctx.Abort()
+		return
+	}
 	switch command {
 	case "插件":
 		if content == "" {
 			return
 		}
 		ok, err = h.PluginManager.HandleManage(content, ctx)
+		h.AdminManager.AuditChat(ctx, command, redactPluginConfig(content), ok, err)
 	case "禁用词":
 		if content == "" {
 			return
 		}
 		ok, err = h.KeywordForbiddenManager.HandleManage(content, ctx)
+		h.AdminManager.AuditChat(ctx, command, content, ok, err)
+	case "管理员":
+		if content == "" {
+			return
+		}
+		ok, err = h.AdminManager.HandleManage(content, ctx)
+		h.AdminManager.AuditChat(ctx, command, content, ok, err)
+	case "限流":
+		if content == "" {
+			return
+		}
+		ok, err = h.QuotaManager.HandleManage(content, ctx)
+		h.AdminManager.AuditChat(ctx, command, content, ok, err)
+	case "敏感词":
+		if content == "" {
+			return
+		}
+		ok, err = h.ModerationManager.HandleManage(content, ctx)
+		h.AdminManager.AuditChat(ctx, command, content, ok, err)
+	case "自动回复":
+		if content == "" {
+			return
+		}
+		ok, err = h.AutoReplyManager.HandleManage(content, ctx)
+		h.AdminManager.AuditChat(ctx, command, content, ok, err)
+	case "定时":
+		if content == "" {
+			return
+		}
+		ok, err = h.ScheduleManager.HandleManage(content, ctx)
+		h.AdminManager.AuditChat(ctx, command, content, ok, err)
+	case "欢迎":
+		if content == "" {
+			return
+		}
+		ok, err = h.WelcomeManager.HandleManage(content, ctx)
+		h.AdminManager.AuditChat(ctx, command, content, ok, err)
+	case "提醒":
+		ok, err = h.ReminderManager.HandleReminder(content, ctx)
 	case "help":
-		addons, _ := h.PluginManager.List(false)
-		switch len(*addons) {
-		case 0:
-			_, _ = ctx.ReplyText("当前没有加载插件")
-		default:
-			msg := "已加载的插件信息如下:\n"
-			for _, v := range *addons {
+		if content != "" {
+			keyword := strings.Fields(content)[0]
+			plugin := h.PluginManager.FindByKeyword(keyword, ctx)
+			if enabled, _ := h.KeywordForbiddenManager.CheckKeyword(ctx, keyword); plugin == nil || !enabled {
+				_, _ = ctx.ReplyText(fmt.Sprintf("当前群没有可用的[%s]插件", keyword))
+			} else {
+				_, _ = ctx.ReplyText(plugin.Info().Help(keyword))
+			}
+			ok, err = true, nil
+			break
+		}
+		msg := ""
+		for _, v := range h.PluginManager.Available(ctx) {
+			if enabled, _ := h.KeywordForbiddenManager.CheckKeyword(ctx, v.BindKeyword); enabled {
 				msg += fmt.Sprintf("[%s]:%s\n", v.BindKeyword, v.Description)
 			}
-			_, _ = ctx.ReplyText(msg)
+		}
+		if msg == "" {
+			_, _ = ctx.ReplyText("当前没有加载插件")
+		} else {
+			_, _ = ctx.ReplyText("已加载的插件信息如下:\n" + msg + "发送 #help 唤醒词 查看详细用法")
 		}
 		ok, err = true, nil
 	default:
@@ -305,6 +494,74 @@ func (h *MsgHandler) dealCommand(ctx *openwechat.MessageContext, command string,
 	}
 }
 
+// moderate 审核消息内容，命中敏感词时中止后续处理
+func (h *MsgHandler) moderate(ctx *openwechat.MessageContext) {
+	if ctx.IsSystem() || ctx.IsSendBySelf() || !ctx.IsText() {
+		return
+	}
+	if h.ModerationManager.Moderate(ctx) {
+		ctx.Abort()
+	}
+}
+
+// sessionHandler 存在插件会话时，消息直接交给插件处理
+func (h *MsgHandler) sessionHandler(ctx *openwechat.MessageContext) {
+	if ctx.IsSystem() || ctx.IsSendBySelf() {
+		return
+	}
+	ok, err := h.PluginManager.InvokeSession(h.DB, ctx)
+	if errors.Is(err, plugin.ErrTimeout) {
+		_, _ = ctx.ReplyText(err.Error())
+		ctx.Abort()
+	} else if err != nil {
+		_, _ = ctx.ReplyText("调用插件出错:" + err.Error())
+		ctx.Abort()
+	} else if ok {
+		ctx.Abort()
+	}
+}
+
+// hookHandler 将消息交给订阅消息的插件，插件要求中止时不再继续处理
+func (h *MsgHandler) hookHandler(ctx *openwechat.MessageContext) {
+	if ctx.IsSystem() || ctx.IsSendBySelf() {
+		return
+	}
+	enabled := func(keyword string) bool {
+		ok, _ := h.KeywordForbiddenManager.CheckKeyword(ctx, keyword)
+		return ok
+	}
+	if h.PluginManager.InvokeHooks(h.DB, ctx, enabled) {
+		ctx.Abort()
+	}
+}
+
+// welcome 新成员入群时发送欢迎
+func (h *MsgHandler) welcome(ctx *openwechat.MessageContext) {
+	if !ctx.IsJoinGroup() {
+		return
+	}
+	group, err := ctx.Sender()
+	if err != nil {
+		return
+	}
+	if names := ParseJoinNames(ctx.Content); len(names) > 0 {
+		h.memberJoined(group.UserName, group.NickName, names)
+	}
+}
+
+// autoReply 对非命令消息按规则自动回复
+func (h *MsgHandler) autoReply(ctx *openwechat.MessageContext) {
+	if ctx.IsSystem() || ctx.IsSendBySelf() || !ctx.IsText() || ctx.IsAt() {
+		return
+	}
+	if strings.HasPrefix(strings.TrimSpace(ctx.Content), "#") {
+		return
+	}
+	if h.AutoReplyManager.Reply(ctx) {
+		ctx.Abort()
+	}
+}
+
 func (h *MsgHandler) checkDuplicate(ctx *openwechat.MessageContext) {
 	if ctx.IsSystem() || ctx.IsNotify() || ctx.IsSendBySelf() {
 		return
@@ -323,7 +580,7 @@ func (h *MsgHandler) checkDuplicate(ctx *openwechat.MessageContext) {
 }
 
 func (h *MsgHandler) preParseContent(ctx *openwechat.MessageContext) {
-	if ctx.IsSystem() || !ctx.IsText() {
+	if ctx.IsSystem() || !(ctx.IsText() || isReferMsg(ctx.Message)) {
 		return
 	}
 	sender, _ := ctx.Sender()
@@ -337,6 +594,10 @@ func (h *MsgHandler) preParseContent(ctx *openwechat.MessageContext) {
 	}
 
 	ctx.Content = openwechat.FormatEmoji(ctx.Content)
+	if isReferMsg(ctx.Message) {
+		h.parseReferMsg(ctx, group)
+		return
+	}
 	// 处理引用内容
 	if strings.HasPrefix(ctx.Content, quotePrefix) && strings.Contains(ctx.Content, quoteSuffix) {
 		// 分离引用内容和正文
@@ -389,11 +650,70 @@ func (h *MsgHandler) preParseContent(ctx *openwechat.MessageContext) {
 			Content: content,
 			Quote:   quoteContent,
 			User:    quoteUser,
+			UID:     quoteUser.UserName,
 		}
+		h.linkQuoteHistory(group.UserName, quote)
 		ctx.Set(QuoteKey, quote)
 	}
 }
 
+// parseReferMsg 解析原生引用消息，转为文本消息继续处理
+func (h *MsgHandler) parseReferMsg(ctx *openwechat.MessageContext, group *openwechat.Group) {
+	refer, ok := ParseReferMsg(ctx.Content)
+	if !ok {
+		return
+	}
+	quote := &QuoteMessageInfo{
+		Content: strings.TrimSpace(refer.AppMsg.Title),
+		Quote:   refer.QuoteContent(),
+		MsgID:   refer.AppMsg.ReferMsg.SvrID,
+		MsgType: refer.AppMsg.ReferMsg.Type,
+	}
+	h.linkQuoteHistory(group.UserName, quote)
+	members, _ := group.Members()
+	if members != nil {
+		if quote.UID != "" {
+			quote.User = members.SearchByUserName(1, quote.UID).First()
+		}
+		// 历史记录中不存在时按显示名称搜索
+		if quote.User == nil {
+			name := refer.AppMsg.ReferMsg.DisplayName
+			quote.User = members.Search(1, func(u *openwechat.User) bool {
+				return name != "" && (u.RemarkName == name || u.DisplayName == name || u.NickName == name)
+			}).First()
+		}
+	}
+	if quote.User != nil {
+		quote.UID = quote.User.UserName
+	}
+	// 引用消息的正文按文本消息处理
+	ctx.MsgType = openwechat.MsgTypeText
+	ctx.Content = quote.Content
+	ctx.Set(QuoteKey, quote)
+}
+
+// linkQuoteHistory 关联被引用消息的历史记录
+func (h *MsgHandler) linkQuoteHistory(gid string, quote *QuoteMessageInfo) {
+	var history MsgHistory
+	tx := h.DB.Model(&MsgHistory{})
+	if quote.MsgID != "" {
+		tx = tx.Where("msg_id = ?", quote.MsgID)
+	} else if quote.UID != "" {
+		tx = tx.Where("g_id = ? and uid = ? and message = ?", gid, quote.UID, quote.Quote).Order("id desc")
+	} else {
+		return
+	}
+	if err := tx.Limit(1).Find(&history).Error; err != nil || history.ID == 0 {
+		return
+	}
+	quote.HistoryID = history.ID
+	quote.MsgID = history.MsgID
+	quote.UID = history.UID
+	if quote.MsgType == 0 {
+		quote.MsgType = history.MsgType
+	}
+}
+
 func (h *MsgHandler) CommandHandler(ctx *openwechat.MessageContext) {
 	if ctx.IsSystem() || ctx.IsSendBySelf() || !ctx.IsText() {
 		return
@@ -405,11 +725,6 @@ func (h *MsgHandler) CommandHandler(ctx *openwechat.MessageContext) {
 		if receiver == nil {
 			return
 		}
-		// 限流
-		if !h.limit.GetOrAdd(sender.UserName).Allow() {
-			ctx.Abort()
-			return
-		}
 		displayName := receiver.First().DisplayName
 		if displayName == "" {
 			displayName = receiver.First().NickName
@@ -437,11 +752,6 @@ func (h *MsgHandler) CommandHandler(ctx *openwechat.MessageContext) {
 		}
 		h.dealCommand(ctx, commands[0], content)
 	} else if strings.HasPrefix(ctx.Content, "#") {
-		// 限流
-		if !h.limit.GetOrAdd(sender.UserName).Allow() {
-			ctx.Abort()
-			return
-		}
 		var quote *QuoteMessageInfo
 		if val, exist := ctx.Get(QuoteKey); exist {
 			quote = val.(*QuoteMessageInfo)
@@ -465,12 +775,7 @@ func (h *MsgHandler) CommandHandler(ctx *openwechat.MessageContext) {
 			quote = val.(*QuoteMessageInfo)
 		}
 		// 判断回复人是否为自己
-		if quote.User.UserName != ctx.Owner().UserName {
-			return
-		}
-		// 限流
-		if !h.limit.GetOrAdd(sender.UserName).Allow() {
-			ctx.Abort()
+		if quote.User == nil || quote.User.UserName != ctx.Owner().UserName {
 			return
 		}
 		content := strings.TrimSpace(quote.Content)
@@ -513,7 +818,9 @@ func (h *MsgHandler) Invoke(command string, params []string, ctx *openwechat.Mes
 		}
 	}
 
-	if ok, err := h.PluginManager.Invoke(keyword, pluginParams, h.DB, ctx); err != nil {
+	if ok, err := h.PluginManager.Invoke(keyword, pluginParams, h.DB, ctx); errors.Is(err, plugin.ErrTimeout) {
+		return false, err
+	} else if err != nil {
 		return false, errors.New("调用插件出错:" + err.Error())
 	} else if ok {
 		return true, nil
@@ -533,6 +840,10 @@ func (h *MsgHandler) Invoke(command string, params []string, ctx *openwechat.Mes
 				username = user.NickName
 			}
 			content := strings.TrimSpace(msg.Content)
+			var mentions []string
+			if v, exist := ctx.Get(MentionKey); exist {
+				mentions = v.([]string)
+			}
 			ok := h.MsgRedirect.RedirectCommand(redirect.CommandMessage{
 				Message: redirect.Message{
 					MsgID:      msg.MsgId,
@@ -543,6 +854,7 @@ func (h *MsgHandler) Invoke(command string, params []string, ctx *openwechat.Mes
 					RawMessage: content,
 					MsgType:    int(msg.MsgType),
 					Time:       msg.CreateTime,
+					Mentions:   mentions,
 				},
 				Command: strings.Join(append([]string{command}, params...), " "),
 			})
@@ -0,0 +1,33 @@
+package bot
+
+import "testing"
+
+func TestRedactPluginConfig(t *testing.T) {
+	cases := map[string]string{
+		"123456 config demo token abc":     "123456 config demo token ******",
+		"123456 config demo token a b c":   "123456 config demo token ******",
+		"123456 config demo":               "123456 config demo",
+		"123456 config demo token":         "123456 config demo token",
+		"123456 install demo token secret": "123456 install demo token secret",
+	}
+	for content, want := range cases {
+		if got := redactPluginConfig(content); got != want {
+			t.Errorf("%s: 期望%q, 实际%q", content, want, got)
+		}
+	}
+}
+
+func TestRedactConfigCommand(t *testing.T) {
+	cases := map[string]string{
+		"#插件 123456 config demo token abc":          "#插件 123456 config demo token ******",
+		"@机器人\u2005插件 123456 config demo token abc": "@机器人 插件 123456 config demo token ******",
+		"#插件 123456 config demo":                    "#插件 123456 config demo",
+		"#插件 123456 install demo":                   "#插件 123456 install demo",
+		"今天的插件 config 很多 不知道 怎么办":                   "今天的插件 config 很多 不知道 怎么办",
+	}
+	for content, want := range cases {
+		if got := redactConfigCommand(content); got != want {
+			t.Errorf("%s: 期望%q, 实际%q", content, want, got)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package bot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/eatmoreapple/openwechat"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"wechat-assistant/admin"
+	"wechat-assistant/util/ahocorasick"
+)
+
+const (
+	ActionWarn   = "warn"   // 群内警告
+	ActionNotify = "notify" // 私聊通知管理员
+	ActionRecord = "record" // 记录违规次数
+	ActionRemove = "remove" // 超过阈值移出群聊,需机器人为群主
+)
+
+type (
+	// SensitiveWord 敏感词
+	SensitiveWord struct {
+		ID      uint   `gorm:"primaryKey;autoIncrement"`
+		Word    string `gorm:"type:varchar(255)"` // 敏感词或正则
+		Regex   bool   ``                         // 是否为正则
+		Setting string `gorm:"type:varchar(255)"` // 群名称或群id,空表示全局
+	}
+
+	// ModerationSetting 群审核处理方式
+	ModerationSetting struct {
+		Setting   string `gorm:"primaryKey;type:varchar(255)"` // 群名称或群id
+		Actions   string `gorm:"type:varchar(100)"`            // 处理动作,逗号分隔
+		Threshold int    `gorm:"type:int(10)"`                 // 移出群聊的违规次数
+	}
+
+	// Violation 群成员违规记录
+	Violation struct {
+		GID        string `gorm:"primaryKey;type:varchar(100)"` // 群名称,群id在重新登录后会变化
+		WechatName string `gorm:"primaryKey;type:varchar(255)"`
+		UID        string `gorm:"type:varchar(100)"`
+		Username   string `gorm:"type:varchar(255)"`
+		Count      int    `gorm:"type:int(10)"`
+		Time       int64  `gorm:"type:int(13)"`
+	}
+
+	moderationRules struct {
+		matcher *ahocorasick.Matcher
+		scopes  map[string][]string // 敏感词生效的群,空表示全局
+		regexes []*regexp.Regexp
+		regexOf map[*regexp.Regexp]string
+	}
+)
+
+type ModerationManager struct {
+	WordsFile      string         `value:"moderation.words"`
+	DefaultActions string         `value:"moderation.actions"`
+	DB             *gorm.DB       `aware:"db"`
+	Admin          *admin.Manager `aware:""`
+	mutex          sync.RWMutex
+	rules          *moderationRules
+}
+
+func (m *ModerationManager) AfterPropertiesSet() {
+	if err := m.DB.AutoMigrate(&SensitiveWord{}, &ModerationSetting{}, &Violation{}); err != nil {
+		log.Fatalln("初始化内容审核表出错", err)
+	}
+	if err := m.reload(); err != nil {
+		log.Fatalln("加载敏感词出错", err)
+	}
+}
+
+// reload 从词库文件和数据库重新构建匹配规则
+func (m *ModerationManager) reload() error {
+	var words []SensitiveWord
+	if m.WordsFile != "" {
+		for _, file := range strings.Split(m.WordsFile, ",") {
+			fileWords, err := readWords(file)
+			if err != nil {
+				return err
+			}
+			words = append(words, fileWords...)
+		}
+	}
+	var records []SensitiveWord
+	if err := m.DB.Find(&records).Error; err != nil {
+		return err
+	}
+	words = append(words, records...)
+
+	rules := &moderationRules{scopes: map[string][]string{}, regexOf: map[*regexp.Regexp]string{}}
+	patterns := make([]string, 0, len(words))
+	for _, w := range words {
+		if w.Regex {
+			re, err := regexp.Compile(w.Word)
+			if err != nil {
+				log.Println("敏感词正则错误", w.Word, err)
+				continue
+			}
+			rules.regexes = append(rules.regexes, re)
+			rules.regexOf[re] = w.Setting
+			continue
+		}
+		word := strings.ToLower(w.Word)
+		if _, ok := rules.scopes[word]; !ok {
+			patterns = append(patterns, word)
+		}
+		rules.scopes[word] = append(rules.scopes[word], w.Setting)
+	}
+	rules.matcher = ahocorasick.NewMatcher(patterns)
+
+	m.mutex.Lock()
+	m.rules = rules
+	m.mutex.Unlock()
+	log.Println("已加载敏感词", rules.matcher.Len(), "正则", len(rules.regexes))
+	return nil
+}
+
+func readWords(file string) ([]SensitiveWord, error) {
+	fp, err := os.Open(strings.TrimSpace(file))
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	var words []SensitiveWord
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		if word := strings.TrimSpace(scanner.Text()); word != "" && !strings.HasPrefix(word, "#") {
+			words = append(words, SensitiveWord{Word: word})
+		}
+	}
+	return words, scanner.Err()
+}
+
+func inScope(scopes []string, group *openwechat.User) bool {
+	for _, scope := range scopes {
+		if scope == "" || strings.EqualFold(scope, group.UserName) || strings.EqualFold(scope, group.NickName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match 返回消息中命中的敏感词
+func (m *ModerationManager) Match(group *openwechat.User, content string) []string {
+	m.mutex.RLock()
+	rules := m.rules
+	m.mutex.RUnlock()
+	if rules == nil {
+		return nil
+	}
+	var hits []string
+	for _, word := range rules.matcher.FindAll(content) {
+		if inScope(rules.scopes[word], group) {
+			hits = append(hits, word)
+		}
+	}
+	for _, re := range rules.regexes {
+		if inScope([]string{rules.regexOf[re]}, group) {
+			if found := re.FindString(content); found != "" {
+				hits = append(hits, found)
+			}
+		}
+	}
+	return hits
+}
+
+// setting 群的处理方式，优先使用按群名称保存的设置
+func (m *ModerationManager) setting(group *openwechat.User) ModerationSetting {
+	setting := ModerationSetting{Actions: m.DefaultActions}
+	if err := m.DB.Take(&setting, "setting = ?", group.NickName).Error; err != nil {
+		m.DB.Take(&setting, "setting = ?", group.UserName)
+	}
+	return setting
+}
+
+// Moderate 审核群消息，命中敏感词时按群设置处理并返回true
+func (m *ModerationManager) Moderate(ctx *openwechat.MessageContext) bool {
+	group, err := ctx.Sender()
+	if err != nil {
+		return false
+	}
+	hits := m.Match(group, ctx.Content)
+	if len(hits) == 0 {
+		return false
+	}
+	user, err := ctx.SenderInGroup()
+	if err != nil {
+		return false
+	}
+	username := user.DisplayName
+	if username == "" {
+		username = user.NickName
+	}
+	log.Println("消息命中敏感词", group.NickName, username, hits)
+
+	setting := m.setting(group)
+	actions := map[string]bool{}
+	for _, action := range strings.Split(setting.Actions, ",") {
+		actions[strings.TrimSpace(action)] = true
+	}
+	count := 0
+	if actions[ActionRecord] || actions[ActionRemove] {
+		count = m.record(group, user, username)
+	}
+	if actions[ActionWarn] {
+		_, _ = ctx.ReplyText(fmt.Sprintf("@%s 请注意言论，消息包含违规内容", username))
+	}
+	if actions[ActionNotify] {
+		m.Admin.NotifyAdmins(ctx, fmt.Sprintf("群[%s]成员[%s]发送违规内容:\n%s\n命中:%s", group.NickName, username, ctx.Content, strings.Join(hits, ",")))
+	}
+	if actions[ActionRemove] && setting.Threshold > 0 && count >= setting.Threshold {
+		if g, ok := group.AsGroup(); ok && g.IsOwner == 1 {
+			if err := g.RemoveMembers(openwechat.Members{user}); err != nil {
+				log.Println("移出群成员失败", username, err)
+			} else {
+				_, _ = ctx.ReplyText(fmt.Sprintf("%s 多次发送违规内容，已被移出群聊", username))
+			}
+		} else {
+			m.Admin.NotifyAdmins(ctx, fmt.Sprintf("群[%s]成员[%s]违规%d次，请手动移出群聊", group.NickName, username, count))
+		}
+	}
+	return true
+}
+
+// record 累加违规次数，返回累计次数
+func (m *ModerationManager) record(group *openwechat.User, user *openwechat.User, username string) int {
+	violation := Violation{
+		GID:        group.NickName,
+		WechatName: user.NickName,
+		UID:        user.UserName,
+		Username:   username,
+		Count:      1,
+		Time:       time.Now().Unix(),
+	}
+	err := m.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "g_id"}, {Name: "wechat_name"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":    gorm.Expr("count + 1"),
+			"uid":      violation.UID,
+			"username": violation.Username,
+			"`time`":   violation.Time,
+		}),
+	}).Create(&violation).Error
+	if err != nil {
+		log.Println("记录违规次数出错", err)
+		return 0
+	}
+	m.DB.Model(&Violation{}).Select("count").
+		Where("g_id = ? and wechat_name = ?", violation.GID, violation.WechatName).
+		Take(&violation.Count)
+	return violation.Count
+}
+
+func (m *ModerationManager) HandleManage(content string, ctx *openwechat.MessageContext) (ok bool, err error) {
+	subCommands := strings.SplitN(content, " ", 3)
+	if len(subCommands) < 2 {
+		return
+	}
+	if !m.Admin.Verify(ctx, subCommands[0]) {
+		return
+	}
+	sender, err := ctx.Sender()
+	if err != nil {
+		return false, err
+	}
+	commands := subCommands[1:]
+	switch commands[0] {
+	case "add":
+		// add 敏感词 [regex] [global]
+		if len(commands) == 1 {
+			return false, errors.New("命令格式错误:请输入敏感词")
+		}
+		params := strings.Fields(commands[1])
+		word := SensitiveWord{Word: params[0], Setting: sender.NickName}
+		for _, param := range params[1:] {
+			switch param {
+			case "regex":
+				if _, err := regexp.Compile(word.Word); err != nil {
+					return false, errors.New("正则表达式错误:" + err.Error())
+				}
+				word.Regex = true
+			case "global":
+				word.Setting = ""
+			}
+		}
+		if err := m.DB.Create(&word).Error; err != nil {
+			return false, errors.New("添加敏感词出错")
+		}
+		_ = m.reload()
+		_, _ = ctx.ReplyText("已添加敏感词:" + word.Word)
+		return true, nil
+	case "del":
+		// del 敏感词ID [global]，global表示删除全局敏感词，否则只能删除当前群的敏感词
+		if len(commands) == 1 {
+			return false, errors.New("命令格式错误:请输入敏感词ID")
+		}
+		params := strings.Fields(commands[1])
+		if len(params) == 0 {
+			return false, errors.New("命令格式错误:请输入敏感词ID")
+		}
+		tx := m.DB.Where("id = ?", params[0])
+		if len(params) > 1 && params[1] == "global" {
+			tx = tx.Where("setting = ?", "")
+		} else {
+			tx = tx.Where("setting <> ? and (setting = ? or setting = ?)", "", sender.UserName, sender.NickName)
+		}
+		res := tx.Delete(&SensitiveWord{})
+		if res.Error != nil {
+			return false, errors.New("删除敏感词出错")
+		}
+		_ = m.reload()
+		if res.RowsAffected == 0 {
+			_, _ = ctx.ReplyText("未找到敏感词")
+		} else {
+			_, _ = ctx.ReplyText("已删除敏感词")
+		}
+		return true, nil
+	case "list":
+		var words []SensitiveWord
+		if err := m.DB.Where("setting = '' or setting = ? or setting = ?", sender.UserName, sender.NickName).Find(&words).Error; err != nil {
+			return false, errors.New("查询敏感词出错")
+		}
+		setting := m.setting(sender)
+		msg := fmt.Sprintf("处理方式:%s 移出阈值:%d\n", setting.Actions, setting.Threshold)
+		for _, w := range words {
+			msg += fmt.Sprintf("%d:%s", w.ID, w.Word)
+			if w.Regex {
+				msg += "(正则)"
+			}
+			if w.Setting == "" {
+				msg += "(全局)"
+			}
+			msg += "\n"
+		}
+		_, _ = ctx.ReplyText(msg)
+		return true, nil
+	case "action":
+		// action warn,notify,record,remove [阈值]
+		if len(commands) == 1 {
+			return false, errors.New("命令格式错误:请输入处理方式")
+		}
+		params := strings.Fields(commands[1])
+		for _, action := range strings.Split(params[0], ",") {
+			switch action {
+			case ActionWarn, ActionNotify, ActionRecord, ActionRemove, "none":
+			default:
+				return false, errors.New("未知处理方式:" + action)
+			}
+		}
+		setting := ModerationSetting{Setting: sender.NickName, Actions: params[0]}
+		if len(params) > 1 {
+			setting.Threshold, _ = strconv.Atoi(params[1])
+		}
+		if err := m.DB.Save(&setting).Error; err != nil {
+			return false, errors.New("保存处理方式出错")
+		}
+		_, _ = ctx.ReplyText(fmt.Sprintf("当前群处理方式已设置为:%s", setting.Actions))
+		return true, nil
+	case "stats":
+		var violations []Violation
+		if err := m.DB.Where("g_id = ? or g_id = ?", sender.NickName, sender.UserName).Order("count desc").Limit(10).Find(&violations).Error; err != nil {
+			return false, errors.New("查询违规记录出错")
+		}
+		if len(violations) == 0 {
+			_, _ = ctx.ReplyText("当前群没有违规记录")
+			return true, nil
+		}
+		msg := "当前群违规记录如下:\n"
+		for _, v := range violations {
+			msg += fmt.Sprintf("%s: %d次\n", v.Username, v.Count)
+		}
+		_, _ = ctx.ReplyText(msg)
+		return true, nil
+	}
+	return false, nil
+}
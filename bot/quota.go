@@ -0,0 +1,290 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/eatmoreapple/openwechat"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"wechat-assistant/admin"
+	"wechat-assistant/util/limiter"
+)
+
+// RatePolicy 限流策略，空值表示匹配全部
+type RatePolicy struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	Setting   string `gorm:"type:varchar(255)"` // 群id或群名称
+	GroupName string `gorm:"type:varchar(255)"` // 群名称,群id在重新登录后会变化
+	User      string `gorm:"type:varchar(255)"` // 用户昵称
+	Command   string `gorm:"type:varchar(255)"` // 命令或唤醒词
+	Limit     int    `gorm:"type:int(10)"`      // 窗口内允许次数
+	Period    int64  `gorm:"type:int(20)"`      // 窗口时长,单位秒
+}
+
+// matchGroup 策略是否适用于群，优先按群名称匹配
+func (p RatePolicy) matchGroup(group *openwechat.User) bool {
+	if p.Setting == "" {
+		return true
+	}
+	if p.GroupName != "" && strings.EqualFold(p.GroupName, group.NickName) {
+		return true
+	}
+	return strings.EqualFold(p.Setting, group.UserName) || strings.EqualFold(p.Setting, group.NickName)
+}
+
+func (p RatePolicy) match(group *openwechat.User, user *openwechat.User, command string) bool {
+	if !p.matchGroup(group) {
+		return false
+	}
+	if p.User != "" && p.User != user.NickName && p.User != user.UserName {
+		return false
+	}
+	return p.Command == "" || p.Command == command
+}
+
+func (p RatePolicy) String() string {
+	scope := "全部群"
+	if p.Setting != "" {
+		scope = "当前群"
+	}
+	user := "每人"
+	if p.User != "" {
+		user = p.User
+	}
+	command := "全部命令"
+	if p.Command != "" {
+		command = p.Command
+	}
+	return fmt.Sprintf("%d: %s %s %s %d次/%d秒", p.ID, scope, user, command, p.Limit, p.Period)
+}
+
+type QuotaManager struct {
+	DB       *gorm.DB       `aware:"db"`
+	Admin    *admin.Manager `aware:""`
+	mutex    sync.RWMutex
+	policies []RatePolicy
+	limit    *limiter.Limiter
+	notified map[string]time.Time // 已提示限流的时间
+	cron     *cron.Cron
+}
+
+func (m *QuotaManager) BeanConstruct() {
+	// 默认每人每秒1次，最多连续2次
+	m.limit = limiter.NewLimiter(rate.Every(1*time.Second), 2)
+	m.notified = map[string]time.Time{}
+}
+
+func (m *QuotaManager) AfterPropertiesSet() {
+	if err := m.DB.AutoMigrate(&RatePolicy{}); err != nil {
+		log.Fatalln("初始化限流策略表出错", err)
+	}
+	if err := m.reload(); err != nil {
+		log.Fatalln("加载限流策略出错", err)
+	}
+	m.cron = cron.New()
+	if _, err := m.cron.AddFunc("@every 10m", m.evict); err != nil {
+		log.Fatalln("添加定时任务出错", err)
+	}
+	m.cron.Start()
+}
+
+func (m *QuotaManager) Destroy() {
+	m.cron.Stop()
+}
+
+func (m *QuotaManager) reload() error {
+	var policies []RatePolicy
+	if err := m.DB.Find(&policies).Error; err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	m.policies = policies
+	m.mutex.Unlock()
+	return nil
+}
+
+// evict 清理闲置的限流器
+func (m *QuotaManager) evict() {
+	m.mutex.RLock()
+	periods := make(map[string]time.Duration, len(m.policies))
+	for _, p := range m.policies {
+		periods[strconv.FormatUint(uint64(p.ID), 10)] = time.Duration(p.Period) * time.Second
+	}
+	m.mutex.RUnlock()
+	count := m.limit.EvictFunc(func(key string) time.Duration {
+		return idleLimit(key, periods)
+	})
+	m.mutex.Lock()
+	for key, t := range m.notified {
+		if time.Now().After(t) {
+			delete(m.notified, key)
+		}
+	}
+	m.mutex.Unlock()
+	if count > 0 {
+		log.Println("清理闲置限流器", count)
+	}
+}
+
+// idleLimit 限流器的闲置清理时长，策略限流器闲置不足一个窗口时清理会重置额度
+func idleLimit(key string, periods map[string]time.Duration) time.Duration {
+	// 策略限流器的key为 策略id:群id:用户id，默认限流器的key为 群id:用户id
+	id, _, _ := strings.Cut(key, ":")
+	if period := periods[id]; period > time.Hour {
+		return period
+	}
+	return time.Hour
+}
+
+// Allow 检查发送者在当前群调用命令是否超出限额，超出时在窗口内提示一次
+func (m *QuotaManager) Allow(ctx *openwechat.MessageContext, command string) bool {
+	group, err := ctx.Sender()
+	if err != nil {
+		return false
+	}
+	user, err := ctx.SenderInGroup()
+	if err != nil {
+		return false
+	}
+	userKey := group.UserName + ":" + user.UserName
+	reservations := []*rate.Reservation{m.limit.GetOrAdd(userKey).Reserve()}
+
+	m.mutex.RLock()
+	policies := make([]RatePolicy, 0, len(m.policies))
+	for _, p := range m.policies {
+		if p.match(group, user, command) {
+			policies = append(policies, p)
+		}
+	}
+	m.mutex.RUnlock()
+	for _, p := range policies {
+		l := m.limit.GetOrAddWith(fmt.Sprintf("%d:%s", p.ID, userKey), rate.Every(time.Duration(p.Period)*time.Second/time.Duration(p.Limit)), p.Limit)
+		reservations = append(reservations, l.Reserve())
+	}
+
+	for i, r := range reservations {
+		if r.OK() && r.Delay() == 0 {
+			continue
+		}
+		for _, reserved := range reservations {
+			reserved.Cancel()
+		}
+		// 默认限流只做拦截，不提示
+		if i == 0 {
+			return false
+		}
+		p := policies[i-1]
+		notifyKey := fmt.Sprintf("%d:%s", p.ID, userKey)
+		m.mutex.Lock()
+		until, notified := m.notified[notifyKey]
+		if !notified || time.Now().After(until) {
+			m.notified[notifyKey] = time.Now().Add(time.Duration(p.Period) * time.Second)
+			notified = false
+		}
+		m.mutex.Unlock()
+		if !notified {
+			_, _ = ctx.ReplyText(fmt.Sprintf("@%s 操作太频繁了，请稍后再试", user.NickName))
+		}
+		return false
+	}
+	return true
+}
+
+func (m *QuotaManager) HandleManage(content string, ctx *openwechat.MessageContext) (ok bool, err error) {
+	subCommands := strings.SplitN(content, " ", 3)
+	if len(subCommands) < 2 {
+		return
+	}
+	if !m.Admin.Verify(ctx, subCommands[0]) {
+		return
+	}
+	sender, err := ctx.Sender()
+	if err != nil {
+		return false, err
+	}
+	commands := subCommands[1:]
+	switch commands[0] {
+	case "add", "global":
+		// add 命令 次数 秒数 [@昵称]
+		if len(commands) == 1 {
+			return false, errors.New("命令格式错误:请输入命令、次数和时长(秒)")
+		}
+		params := strings.Fields(commands[1])
+		if len(params) < 3 {
+			return false, errors.New("命令格式错误:请输入命令、次数和时长(秒)")
+		}
+		limit, err := strconv.Atoi(params[1])
+		if err != nil || limit <= 0 {
+			return false, errors.New("命令格式错误:次数必须为正整数")
+		}
+		period, err := strconv.ParseInt(params[2], 10, 64)
+		if err != nil || period <= 0 {
+			return false, errors.New("命令格式错误:时长必须为正整数")
+		}
+		policy := RatePolicy{Limit: limit, Period: period}
+		if params[0] != "*" {
+			policy.Command = params[0]
+		}
+		if commands[0] == "add" {
+			policy.Setting = sender.UserName
+			policy.GroupName = sender.NickName
+		}
+		if len(params) > 3 {
+			policy.User = strings.TrimPrefix(strings.Join(params[3:], " "), "@")
+		}
+		if err := m.DB.Create(&policy).Error; err != nil {
+			return false, errors.New("添加限流策略出错")
+		}
+		_ = m.reload()
+		_, _ = ctx.ReplyText("已添加限流策略 " + policy.String())
+		return true, nil
+	case "del":
+		// del 策略ID [global]，global表示删除全局策略，否则只能删除当前群的策略
+		if len(commands) == 1 {
+			return false, errors.New("命令格式错误:请输入策略ID")
+		}
+		params := strings.Fields(commands[1])
+		if len(params) == 0 {
+			return false, errors.New("命令格式错误:请输入策略ID")
+		}
+		tx := m.DB.Where("id = ?", params[0])
+		if len(params) > 1 && params[1] == "global" {
+			tx = tx.Where("setting = ?", "")
+		} else {
+			tx = tx.Where("setting <> ? and (setting = ? or setting = ? or group_name = ?)", "", sender.UserName, sender.NickName, sender.NickName)
+		}
+		res := tx.Delete(&RatePolicy{})
+		if res.Error != nil {
+			return false, errors.New("删除限流策略出错")
+		}
+		_ = m.reload()
+		if res.RowsAffected == 0 {
+			_, _ = ctx.ReplyText("未找到限流策略")
+		} else {
+			_, _ = ctx.ReplyText("已删除限流策略")
+		}
+		return true, nil
+	case "list":
+		m.mutex.RLock()
+		msg := ""
+		for _, p := range m.policies {
+			if p.matchGroup(sender) {
+				msg += p.String() + "\n"
+			}
+		}
+		m.mutex.RUnlock()
+		if msg == "" {
+			_, _ = ctx.ReplyText("当前群没有限流策略")
+		} else {
+			_, _ = ctx.ReplyText("当前群的限流策略如下:\n" + msg)
+		}
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,50 @@
+package bot
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"testing"
+	"time"
+)
+
+func TestRatePolicyMatch(t *testing.T) {
+	group := &openwechat.User{UserName: "@@new", NickName: "测试群"}
+	user := &openwechat.User{UserName: "@user", NickName: "张三"}
+	cases := []struct {
+		name    string
+		policy  RatePolicy
+		command string
+		want    bool
+	}{
+		{"全局策略", RatePolicy{}, "插件", true},
+		{"群id", RatePolicy{Setting: "@@new"}, "插件", true},
+		{"重新登录后群id变化", RatePolicy{Setting: "@@old", GroupName: "测试群"}, "插件", true},
+		{"其他群", RatePolicy{Setting: "@@other", GroupName: "其他群"}, "插件", false},
+		{"用户昵称", RatePolicy{User: "张三"}, "插件", true},
+		{"其他用户", RatePolicy{User: "李四"}, "插件", false},
+		{"命令", RatePolicy{Command: "插件"}, "插件", true},
+		{"其他命令", RatePolicy{Command: "禁用词"}, "插件", false},
+	}
+	for _, c := range cases {
+		if got := c.policy.match(group, user, c.command); got != c.want {
+			t.Errorf("%s: 期望%v, 实际%v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestIdleLimit(t *testing.T) {
+	periods := map[string]time.Duration{"1": time.Minute, "2": 24 * time.Hour}
+	cases := []struct {
+		key  string
+		want time.Duration
+	}{
+		{"@@group:@user", time.Hour},
+		{"1:@@group:@user", time.Hour},
+		{"2:@@group:@user", 24 * time.Hour},
+		{"3:@@group:@user", time.Hour},
+	}
+	for _, c := range cases {
+		if got := idleLimit(c.key, periods); got != c.want {
+			t.Errorf("%s: 期望%v, 实际%v", c.key, c.want, got)
+		}
+	}
+}
@@ -1,15 +1,83 @@
 package bot
 
-import "github.com/eatmoreapple/openwechat"
+import (
+	"encoding/xml"
+	"github.com/eatmoreapple/openwechat"
+	"strings"
+)
 
 const (
 	quotePrefix = "「"
 	quoteSuffix = "」\n- - - - - - - - - - - - - - -\n"
 	QuoteKey    = "quote"
+
+	// AppMsgTypeRefer 引用消息
+	AppMsgTypeRefer openwechat.AppMessageType = 57
 )
 
 type QuoteMessageInfo struct {
-	Content string
-	Quote   string
-	User    *openwechat.User
+	Content   string
+	Quote     string
+	User      *openwechat.User
+	UID       string // 被引用消息发送人id
+	MsgID     string // 被引用消息id
+	MsgType   int    // 被引用消息类型
+	HistoryID uint   // 被引用消息的历史记录id
+}
+
+// ReferMsg 原生引用消息
+type ReferMsg struct {
+	AppMsg struct {
+		Title    string `xml:"title"`
+		Type     int    `xml:"type"`
+		ReferMsg struct {
+			Type        int    `xml:"type"`
+			SvrID       string `xml:"svrid"`
+			FromUsr     string `xml:"fromusr"`
+			ChatUsr     string `xml:"chatusr"`
+			DisplayName string `xml:"displayname"`
+			Content     string `xml:"content"`
+		} `xml:"refermsg"`
+	} `xml:"appmsg"`
+}
+
+// referTypeNames 非文本引用消息的展示内容
+var referTypeNames = map[int]string{
+	int(openwechat.MsgTypeImage):    "[图片]",
+	int(openwechat.MsgTypeVoice):    "[语音]",
+	int(openwechat.MsgTypeVideo):    "[视频]",
+	int(openwechat.MsgTypeEmoticon): "[表情]",
+	int(openwechat.MsgTypeLocation): "[位置]",
+	int(openwechat.MsgTypeApp):      "[链接]",
+}
+
+func isReferMsg(msg *openwechat.Message) bool {
+	return msg.MsgType == openwechat.MsgTypeApp && msg.AppMsgType == AppMsgTypeRefer
+}
+
+// ParseReferMsg 解析原生引用消息
+func ParseReferMsg(content string) (*ReferMsg, bool) {
+	// 群消息内容可能带有发送人前缀
+	if i := strings.Index(content, "<msg>"); i > 0 {
+		content = content[i:]
+	}
+	var refer ReferMsg
+	if err := xml.Unmarshal([]byte(content), &refer); err != nil {
+		return nil, false
+	}
+	if refer.AppMsg.Type != int(AppMsgTypeRefer) || refer.AppMsg.ReferMsg.SvrID == "" {
+		return nil, false
+	}
+	return &refer, true
+}
+
+// QuoteContent 被引用消息的展示内容
+func (r *ReferMsg) QuoteContent() string {
+	if r.AppMsg.ReferMsg.Type == int(openwechat.MsgTypeText) {
+		return strings.TrimSpace(r.AppMsg.ReferMsg.Content)
+	}
+	if name, ok := referTypeNames[r.AppMsg.ReferMsg.Type]; ok {
+		return name
+	}
+	return "[消息]"
 }
@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+)
+
+const referXml = `<msg><appmsg appid="" sdkver="0"><title>收到</title><type>57</type>` +
+	`<refermsg><type>%d</type><svrid>1234567890</svrid><fromusr>@@group</fromusr><chatusr>@user</chatusr>` +
+	`<displayname>张三</displayname><content>%s</content></refermsg></appmsg></msg>`
+
+func TestParseReferMsg(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		ok      bool
+		quote   string
+	}{
+		{"文本", fmt.Sprintf(referXml, 1, " 今天开会吗 "), true, "今天开会吗"},
+		{"发送人前缀", "@user:\n" + fmt.Sprintf(referXml, 1, "今天开会吗"), true, "今天开会吗"},
+		{"图片", fmt.Sprintf(referXml, 3, "&lt;msg&gt;&lt;img /&gt;&lt;/msg&gt;"), true, "[图片]"},
+		{"未知类型", fmt.Sprintf(referXml, 10000, ""), true, "[消息]"},
+		{"非引用消息", `<msg><appmsg><title>链接</title><type>5</type></appmsg></msg>`, false, ""},
+		{"缺少消息id", `<msg><appmsg><title>收到</title><type>57</type><refermsg><type>1</type></refermsg></appmsg></msg>`, false, ""},
+		{"格式错误", "普通文本", false, ""},
+	}
+	for _, c := range cases {
+		refer, ok := ParseReferMsg(c.content)
+		if ok != c.ok {
+			t.Errorf("%s: 期望%v, 实际%v", c.name, c.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if refer.AppMsg.Title != "收到" || refer.AppMsg.ReferMsg.SvrID != "1234567890" || refer.AppMsg.ReferMsg.ChatUsr != "@user" {
+			t.Errorf("%s: 解析结果错误 %+v", c.name, refer.AppMsg)
+		}
+		if quote := refer.QuoteContent(); quote != c.quote {
+			t.Errorf("%s: 期望引用内容%q, 实际%q", c.name, c.quote, quote)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/eatmoreapple/openwechat"
+	"strconv"
+	"strings"
+	"time"
+	"wechat-assistant/util/timeparse"
+)
+
+// ReminderManager 自然语言提醒，基于定时消息实现
+type ReminderManager struct {
+	Schedule *ScheduleManager `aware:""`
+}
+
+func (m *ReminderManager) HandleReminder(content string, ctx *openwechat.MessageContext) (bool, error) {
+	group, err := ctx.Sender()
+	if err != nil {
+		return false, err
+	}
+	user, err := ctx.SenderInGroup()
+	if err != nil {
+		return false, err
+	}
+	username := user.DisplayName
+	if username == "" {
+		username = user.NickName
+	}
+	params := strings.Fields(content)
+	if len(params) == 0 {
+		return false, errors.New("命令格式错误,示例:#提醒 10分钟后 开会")
+	}
+	switch params[0] {
+	case "list":
+		reminders, err := m.List(group, user)
+		if err != nil {
+			return false, errors.New("查询提醒出错")
+		}
+		if len(reminders) == 0 {
+			_, _ = ctx.ReplyText(fmt.Sprintf("@%s 你当前没有待执行的提醒", username))
+			return true, nil
+		}
+		msg := fmt.Sprintf("@%s 你的提醒如下:\n", username)
+		for _, r := range reminders {
+			msg += fmt.Sprintf("%d: %s %s\n", r.ID, time.Unix(r.RunAt, 0).Format("01-02 15:04"), r.Body)
+		}
+		_, _ = ctx.ReplyText(msg)
+		return true, nil
+	case "cancel":
+		if len(params) < 2 {
+			return false, errors.New("命令格式错误:请输入提醒ID")
+		}
+		id, err := strconv.ParseUint(params[1], 10, 64)
+		if err != nil {
+			return false, errors.New("命令格式错误:提醒ID错误")
+		}
+		reminder := new(ScheduledMessage)
+		if err := m.Schedule.DB.Take(reminder, "id = ? and (g_id = ? or group_name = ?) and creator = ? and spec = ''", id, group.UserName, group.NickName, user.NickName).Error; err != nil {
+			return false, errors.New("未找到你的提醒")
+		}
+		if _, err := m.Schedule.Delete(reminder.ID, group.UserName, group.NickName); err != nil {
+			return false, errors.New("取消提醒出错")
+		}
+		_, _ = ctx.ReplyText(fmt.Sprintf("@%s 已取消提醒:%s", username, reminder.Body))
+		return true, nil
+	}
+
+	runAt, rest, err := timeparse.Parse(content, time.Now())
+	if err != nil {
+		return false, errors.New("无法识别提醒时间,示例:#提醒 明天9点 交周报")
+	}
+	if rest == "" {
+		return false, errors.New("请输入提醒事项")
+	}
+	reminder := &ScheduledMessage{
+		GID:       group.UserName,
+		GroupName: group.NickName,
+		RunAt:     runAt.Unix(),
+		Type:      1,
+		Body:      "提醒:" + rest,
+		Creator:   user.NickName,
+		Mention:   username,
+		Enabled:   true,
+	}
+	if err := m.Schedule.Save(reminder); err != nil {
+		return false, errors.New("添加提醒出错:" + err.Error())
+	}
+	_, _ = ctx.ReplyText(fmt.Sprintf("@%s 好的，将在%s提醒你:%s", username, runAt.Format("01-02 15:04"), rest))
+	return true, nil
+}
+
+// List 查询用户在群内待执行的提醒
+func (m *ReminderManager) List(group *openwechat.User, user *openwechat.User) ([]ScheduledMessage, error) {
+	var reminders []ScheduledMessage
+	err := m.Schedule.DB.
+		Where("(g_id = ? or group_name = ?) and creator = ? and spec = '' and enabled = ?", group.UserName, group.NickName, user.NickName, true).
+		Order("run_at").
+		Find(&reminders).Error
+	return reminders, err
+}
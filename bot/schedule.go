@@ -0,0 +1,359 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/eatmoreapple/openwechat"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"wechat-assistant/admin"
+	"wechat-assistant/lock"
+	"wechat-assistant/redirect"
+)
+
+const (
+	// missedTolerance 重启后补发错过的单次定时消息的最长时间，发送失败时也在此时间内重试
+	missedTolerance = time.Hour
+	// retryDelay 单次定时消息发送失败后的重试间隔
+	retryDelay = time.Minute
+)
+
+var scheduleParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ScheduledMessage 定时消息
+type ScheduledMessage struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	GID       string `gorm:"type:varchar(100)" json:"gid"`       // 群id
+	GroupName string `gorm:"type:varchar(255)" json:"groupName"` // 群名称,群id失效时使用
+	Spec      string `gorm:"type:varchar(100)" json:"spec"`      // cron表达式,为空时为单次消息
+	RunAt     int64  `gorm:"type:int(13)" json:"runAt"`          // 单次消息发送时间
+	Type      int    `gorm:"type:int(2)" json:"type"`            // 消息类型 1:文本,2:图片,3:视频,4:文件
+	Body      string `json:"body"`                               // 文本内容或资源地址
+	Filename  string `gorm:"type:varchar(255)" json:"filename"`  // 文件名称
+	Prompt    string `gorm:"type:varchar(255)" json:"prompt"`    // 发送媒体资源前的提示词
+	Creator   string `gorm:"type:varchar(255)" json:"creator"`   // 创建人微信昵称,提醒消息使用
+	Mention   string `gorm:"type:varchar(255)" json:"mention"`   // 发送时@的群成员名称
+	Enabled   bool   `json:"enabled"`                            // 是否启用
+	LastRun   int64  `gorm:"type:int(13)" json:"lastRun"`        // 最后一次发送时间
+	Time      int64  `gorm:"type:int(13)" json:"time"`
+}
+
+func (s ScheduledMessage) String() string {
+	when := s.Spec
+	if when == "" {
+		when = time.Unix(s.RunAt, 0).Format("2006-01-02 15:04")
+	}
+	body := []rune(s.Body)
+	if len(body) > 20 {
+		body = append(body[:20], []rune("...")...)
+	}
+	status := ""
+	if !s.Enabled {
+		status = "(已停用)"
+	}
+	return fmt.Sprintf("%d:[%s] %s%s", s.ID, when, string(body), status)
+}
+
+func (s ScheduledMessage) validate() error {
+	if s.GID == "" && s.GroupName == "" {
+		return errors.New("群id或群名称不能为空")
+	}
+	if s.Body == "" {
+		return errors.New("消息内容不能为空")
+	}
+	if s.Type < 1 || s.Type > 4 {
+		return errors.New("消息类型错误")
+	}
+	if s.Spec != "" {
+		if _, err := scheduleParser.Parse(s.Spec); err != nil {
+			return errors.New("cron表达式错误:" + err.Error())
+		}
+	} else if s.RunAt <= time.Now().Unix() {
+		return errors.New("发送时间必须晚于当前时间")
+	}
+	return nil
+}
+
+type ScheduleManager struct {
+	DB      *gorm.DB            `aware:"db"`
+	Locker  lock.Locker         `aware:""`
+	Admin   *admin.Manager      `aware:""`
+	Sender  *redirect.MsgSender `aware:""`
+	mutex   sync.Mutex
+	cron    *cron.Cron
+	entries map[uint]cron.EntryID
+	timers  map[uint]*time.Timer
+}
+
+func (m *ScheduleManager) BeanConstruct() {
+	m.cron = cron.New(cron.WithParser(scheduleParser))
+	m.entries = map[uint]cron.EntryID{}
+	m.timers = map[uint]*time.Timer{}
+}
+
+func (m *ScheduleManager) AfterPropertiesSet() {
+	if err := m.DB.AutoMigrate(&ScheduledMessage{}); err != nil {
+		log.Fatalln("初始化定时消息表出错", err)
+	}
+}
+
+// Initialized 加载已保存的定时消息
+func (m *ScheduleManager) Initialized() {
+	var messages []ScheduledMessage
+	if err := m.DB.Where("enabled = ?", true).Find(&messages).Error; err != nil {
+		log.Println("加载定时消息出错", err)
+	}
+	for _, msg := range messages {
+		m.arm(msg)
+	}
+	m.cron.Start()
+	log.Println("已加载定时消息", len(messages))
+}
+
+func (m *ScheduleManager) Destroy() {
+	m.cron.Stop()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, timer := range m.timers {
+		timer.Stop()
+	}
+}
+
+// arm 注册定时任务
+func (m *ScheduleManager) arm(msg ScheduledMessage) {
+	m.disarm(msg.ID)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	id := msg.ID
+	if msg.Spec != "" {
+		entryId, err := m.cron.AddFunc(msg.Spec, func() { m.execute(id) })
+		if err != nil {
+			log.Println("注册定时消息出错", id, err)
+			return
+		}
+		m.entries[id] = entryId
+		return
+	}
+	delay := time.Until(time.Unix(msg.RunAt, 0))
+	if delay < 0 {
+		if -delay > missedTolerance {
+			log.Println("定时消息已过期", id)
+			m.DB.Model(&ScheduledMessage{}).Where("id = ?", id).Update("enabled", false)
+			return
+		}
+		// 错过的消息等待登录完成后补发
+		delay = retryDelay
+	}
+	m.timers[id] = time.AfterFunc(delay, func() { m.execute(id) })
+}
+
+// disarm 注销定时任务
+func (m *ScheduleManager) disarm(id uint) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if entryId, ok := m.entries[id]; ok {
+		m.cron.Remove(entryId)
+		delete(m.entries, id)
+	}
+	if timer, ok := m.timers[id]; ok {
+		timer.Stop()
+		delete(m.timers, id)
+	}
+}
+
+// execute 发送定时消息，通过数据库锁保证多实例时只发送一次
+func (m *ScheduleManager) execute(id uint) {
+	if access, err := m.Locker.Lock(fmt.Sprintf("schedule:%d", id), 10*time.Second); err != nil || access != 0 {
+		return
+	}
+	msg := new(ScheduledMessage)
+	if err := m.DB.Take(msg, "id = ? and enabled = ?", id, true).Error; err != nil {
+		return
+	}
+	if err := m.send(*msg); err != nil {
+		log.Println("发送定时消息失败", id, err)
+		if msg.Spec == "" {
+			m.retry(*msg)
+		}
+		return
+	}
+	updates := map[string]interface{}{"last_run": time.Now().Unix()}
+	if msg.Spec == "" {
+		updates["enabled"] = false
+		m.disarm(id)
+	}
+	m.DB.Model(&ScheduledMessage{}).Where("id = ?", id).Updates(updates)
+}
+
+// retry 单次定时消息发送失败后稍后重试，超过补发时间后停用
+func (m *ScheduleManager) retry(msg ScheduledMessage) {
+	if time.Since(time.Unix(msg.RunAt, 0)) > missedTolerance {
+		log.Println("定时消息多次发送失败，已停用", msg.ID)
+		m.disarm(msg.ID)
+		m.DB.Model(&ScheduledMessage{}).Where("id = ?", msg.ID).Update("enabled", false)
+		return
+	}
+	id := msg.ID
+	m.disarm(id)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.timers[id] = time.AfterFunc(retryDelay, func() { m.execute(id) })
+}
+
+func (m *ScheduleManager) send(msg ScheduledMessage) (err error) {
+	if msg.Type == 1 {
+		if msg.Mention != "" {
+			msg.Body = "@" + msg.Mention + "\u2005" + msg.Body
+		}
+		if msg.GID != "" {
+			if _, err = m.Sender.SendGroupTextMsgByGid(msg.GID, msg.Body); err == nil {
+				return nil
+			}
+		}
+		if msg.GroupName != "" {
+			_, err = m.Sender.SendGroupTextMsgByGroupName(msg.GroupName, msg.Body)
+		}
+		return err
+	}
+	if msg.GID != "" {
+		if _, err = m.Sender.SendGroupMediaMsgByGid(msg.GID, msg.Type, msg.Body, msg.Filename, msg.Prompt); err == nil {
+			return nil
+		}
+	}
+	if msg.GroupName != "" {
+		_, err = m.Sender.SendGroupMediaMsgByGroupName(msg.GroupName, msg.Type, msg.Body, msg.Filename, msg.Prompt)
+	}
+	return err
+}
+
+// Save 新增或更新定时消息并重新注册
+func (m *ScheduleManager) Save(msg *ScheduledMessage) error {
+	if msg.Type == 0 {
+		msg.Type = 1
+	}
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	msg.Time = time.Now().Unix()
+	if err := m.DB.Save(msg).Error; err != nil {
+		return err
+	}
+	if msg.Enabled {
+		m.arm(*msg)
+	} else {
+		m.disarm(msg.ID)
+	}
+	return nil
+}
+
+// Delete 删除定时消息，gid和groupName不为空时只删除该群的定时消息
+func (m *ScheduleManager) Delete(id uint, gid string, groupName string) (bool, error) {
+	tx := m.DB.Where("id = ?", id)
+	if gid != "" || groupName != "" {
+		tx = tx.Where("g_id = ? or group_name = ?", gid, groupName)
+	}
+	res := tx.Delete(&ScheduledMessage{})
+	if res.Error == nil && res.RowsAffected > 0 {
+		m.disarm(id)
+	}
+	return res.RowsAffected > 0, res.Error
+}
+
+// List 查询群的定时消息，gid和groupName均为空时返回全部
+func (m *ScheduleManager) List(gid string, groupName string) ([]ScheduledMessage, error) {
+	var messages []ScheduledMessage
+	tx := m.DB.Model(&ScheduledMessage{})
+	if gid != "" || groupName != "" {
+		tx = tx.Where("g_id = ? or group_name = ?", gid, groupName)
+	}
+	err := tx.Order("id").Find(&messages).Error
+	return messages, err
+}
+
+func (m *ScheduleManager) HandleManage(content string, ctx *openwechat.MessageContext) (ok bool, err error) {
+	subCommands := strings.SplitN(content, " ", 3)
+	if len(subCommands) < 2 {
+		return
+	}
+	if !m.Admin.Verify(ctx, subCommands[0]) {
+		return
+	}
+	sender, err := ctx.Sender()
+	if err != nil {
+		return false, err
+	}
+	commands := subCommands[1:]
+	switch commands[0] {
+	case "add", "once":
+		// add cron表达式 | 内容
+		// once 2006-01-02 15:04 | 内容
+		if len(commands) == 1 || !strings.Contains(commands[1], "|") {
+			return false, errors.New("命令格式错误:请使用 时间 | 内容 的格式")
+		}
+		parts := strings.SplitN(commands[1], "|", 2)
+		msg := &ScheduledMessage{
+			GID:       sender.UserName,
+			GroupName: sender.NickName,
+			Type:      1,
+			Body:      strings.TrimSpace(parts[1]),
+			Enabled:   true,
+		}
+		for prefix, msgType := range map[string]int{"image:": 2, "video:": 3, "file:": 4} {
+			if strings.HasPrefix(msg.Body, prefix) {
+				msg.Type = msgType
+				msg.Body = strings.TrimPrefix(msg.Body, prefix)
+			}
+		}
+		if commands[0] == "add" {
+			msg.Spec = strings.TrimSpace(parts[0])
+		} else {
+			runAt, err := time.ParseInLocation("2006-01-02 15:04", strings.TrimSpace(parts[0]), time.Local)
+			if err != nil {
+				return false, errors.New("时间格式错误,示例:2006-01-02 15:04")
+			}
+			msg.RunAt = runAt.Unix()
+		}
+		if err := m.Save(msg); err != nil {
+			return false, errors.New("添加定时消息出错:" + err.Error())
+		}
+		_, _ = ctx.ReplyText("已添加定时消息 " + msg.String())
+		return true, nil
+	case "del":
+		if len(commands) == 1 {
+			return false, errors.New("命令格式错误:请输入定时消息ID")
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(commands[1]), 10, 64)
+		if err != nil {
+			return false, errors.New("命令格式错误:定时消息ID错误")
+		}
+		if ok, err := m.Delete(uint(id), sender.UserName, sender.NickName); err != nil {
+			return false, errors.New("删除定时消息出错")
+		} else if !ok {
+			_, _ = ctx.ReplyText("未找到定时消息")
+		} else {
+			_, _ = ctx.ReplyText("已删除定时消息")
+		}
+		return true, nil
+	case "list":
+		messages, err := m.List(sender.UserName, sender.NickName)
+		if err != nil {
+			return false, errors.New("查询定时消息出错")
+		}
+		if len(messages) == 0 {
+			_, _ = ctx.ReplyText("当前群没有定时消息")
+			return true, nil
+		}
+		msg := "当前群的定时消息如下:\n"
+		for _, v := range messages {
+			msg += v.String() + "\n"
+		}
+		_, _ = ctx.ReplyText(msg)
+		return true, nil
+	}
+	return false, nil
+}
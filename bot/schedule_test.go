@@ -0,0 +1,124 @@
+package bot
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+	"wechat-assistant/redirect"
+)
+
+type stubLocker struct{}
+
+func (stubLocker) Lock(string, time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (stubLocker) Update(string, time.Duration) {}
+
+func newScheduleManager(t *testing.T) *ScheduleManager {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&ScheduledMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	// 未登录的机器人，发送消息均会失败
+	m := &ScheduleManager{DB: db, Locker: stubLocker{}, Sender: &redirect.MsgSender{Bot: openwechat.DefaultBot()}}
+	m.BeanConstruct()
+	t.Cleanup(m.Destroy)
+	return m
+}
+
+func TestScheduleArm(t *testing.T) {
+	m := newScheduleManager(t)
+	messages := []ScheduledMessage{
+		{ID: 1, GID: "@@group", Spec: "0 9 * * *", Body: "早上好", Type: 1, Enabled: true},
+		{ID: 2, GID: "@@group", RunAt: time.Now().Add(time.Hour).Unix(), Body: "稍后", Type: 1, Enabled: true},
+		{ID: 3, GID: "@@group", RunAt: time.Now().Add(-time.Minute).Unix(), Body: "错过", Type: 1, Enabled: true},
+		{ID: 4, GID: "@@group", RunAt: time.Now().Add(-2 * missedTolerance).Unix(), Body: "过期", Type: 1, Enabled: true},
+	}
+	if err := m.DB.Create(&messages).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages {
+		m.arm(msg)
+	}
+	if _, ok := m.entries[1]; !ok {
+		t.Fatal("周期消息应注册定时任务")
+	}
+	if _, ok := m.timers[2]; !ok {
+		t.Fatal("单次消息应注册定时器")
+	}
+	if _, ok := m.timers[3]; !ok {
+		t.Fatal("错过的单次消息应稍后补发")
+	}
+	if _, ok := m.timers[4]; ok {
+		t.Fatal("过期的单次消息不应注册")
+	}
+	expired := new(ScheduledMessage)
+	m.DB.Take(expired, "id = ?", 4)
+	if expired.Enabled {
+		t.Fatal("过期的单次消息应停用")
+	}
+
+	m.disarm(1)
+	m.disarm(2)
+	if len(m.entries) != 0 || m.timers[2] != nil {
+		t.Fatal("注销后不应保留定时任务")
+	}
+}
+
+func TestScheduleExecuteRetry(t *testing.T) {
+	m := newScheduleManager(t)
+	missed := ScheduledMessage{ID: 1, GID: "@@group", RunAt: time.Now().Add(-time.Minute).Unix(), Body: "错过", Type: 1, Enabled: true}
+	expired := ScheduledMessage{ID: 2, GID: "@@group", RunAt: time.Now().Add(-2 * missedTolerance).Unix(), Body: "过期", Type: 1, Enabled: true}
+	if err := m.DB.Create(&[]ScheduledMessage{missed, expired}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 发送失败的单次消息保持启用并稍后重试
+	m.execute(missed.ID)
+	msg := new(ScheduledMessage)
+	m.DB.Take(msg, "id = ?", missed.ID)
+	if !msg.Enabled || msg.LastRun != 0 {
+		t.Fatalf("发送失败不应停用消息 %v", msg)
+	}
+	if _, ok := m.timers[missed.ID]; !ok {
+		t.Fatal("发送失败应重新注册定时器")
+	}
+
+	// 超过补发时间后停用
+	m.execute(expired.ID)
+	msg = new(ScheduledMessage)
+	m.DB.Take(msg, "id = ?", expired.ID)
+	if msg.Enabled {
+		t.Fatal("超过补发时间的消息应停用")
+	}
+	if _, ok := m.timers[expired.ID]; ok {
+		t.Fatal("停用的消息不应重试")
+	}
+}
+
+func TestScheduleDelete(t *testing.T) {
+	m := newScheduleManager(t)
+	msg := ScheduledMessage{ID: 1, GID: "@@group", GroupName: "测试群", Spec: "0 9 * * *", Body: "早上好", Type: 1, Enabled: true}
+	if err := m.DB.Create(&msg).Error; err != nil {
+		t.Fatal(err)
+	}
+	m.arm(msg)
+	if ok, _ := m.Delete(msg.ID, "@@other", "其他群"); ok {
+		t.Fatal("不能删除其他群的定时消息")
+	}
+	if _, ok := m.entries[msg.ID]; !ok {
+		t.Fatal("删除失败时不应注销定时任务")
+	}
+	if ok, err := m.Delete(msg.ID, "@@new", "测试群"); !ok || err != nil {
+		t.Fatalf("期望按群名称删除, 实际%v %v", ok, err)
+	}
+	if _, ok := m.entries[msg.ID]; ok {
+		t.Fatal("删除后应注销定时任务")
+	}
+}
@@ -0,0 +1,290 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/eatmoreapple/openwechat"
+	"gorm.io/gorm"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"wechat-assistant/admin"
+	"wechat-assistant/redirect"
+)
+
+const (
+	// welcomeBatchDelay 等待同一批入群成员的时间
+	welcomeBatchDelay = 10 * time.Second
+	// welcomeDedupWindow 同一成员重复欢迎的间隔，避免系统消息和群成员刷新重复触发
+	welcomeDedupWindow = 30 * time.Minute
+	defaultWelcome     = "欢迎 {names} 加入{group}"
+)
+
+var joinNamePattern = regexp.MustCompile(`"([^"]+)"`)
+
+// WelcomeSetting 新成员入群欢迎设置
+type WelcomeSetting struct {
+	ID       uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Setting  string `gorm:"type:varchar(255);uniqueIndex" json:"setting"` // 群id或群名称
+	Template string `json:"template"`                                     // 欢迎语,支持{names}{group}{count}{time}变量
+	Image    string `json:"image"`                                        // 欢迎图片地址,为空时不发送
+	Cooldown int64  `gorm:"type:int(10)" json:"cooldown"`                 // 冷却时长,单位秒
+	Enabled  bool   `json:"enabled"`                                      // 是否启用
+	Time     int64  `gorm:"type:int(13)" json:"time"`
+}
+
+func (s WelcomeSetting) String() string {
+	status := "启用"
+	if !s.Enabled {
+		status = "停用"
+	}
+	msg := fmt.Sprintf("%d:%s 冷却%d秒 %s\n欢迎语:%s", s.ID, s.Setting, s.Cooldown, status, s.Template)
+	if s.Image != "" {
+		msg += "\n图片:" + s.Image
+	}
+	return msg
+}
+
+type welcomeBatch struct {
+	groupName string
+	names     []string
+	timer     *time.Timer
+}
+
+type WelcomeManager struct {
+	DB       *gorm.DB            `aware:"db"`
+	Admin    *admin.Manager      `aware:""`
+	Sender   *redirect.MsgSender `aware:""`
+	mutex    sync.Mutex
+	pending  map[string]*welcomeBatch // 等待发送的欢迎
+	lastSent map[string]time.Time     // 群最后一次发送欢迎的时间
+	welcomed map[string]time.Time     // 已欢迎的成员
+}
+
+func (m *WelcomeManager) BeanConstruct() {
+	m.pending = map[string]*welcomeBatch{}
+	m.lastSent = map[string]time.Time{}
+	m.welcomed = map[string]time.Time{}
+}
+
+func (m *WelcomeManager) AfterPropertiesSet() {
+	if err := m.DB.AutoMigrate(&WelcomeSetting{}); err != nil {
+		log.Fatalln("初始化入群欢迎表出错", err)
+	}
+}
+
+// ParseJoinNames 从入群系统消息中解析新成员名称
+func ParseJoinNames(content string) []string {
+	if strings.Contains(content, "分享的二维码加入群聊") {
+		// "新成员"通过扫描"邀请人"分享的二维码加入群聊
+		if match := joinNamePattern.FindStringSubmatch(content); match != nil {
+			return []string{match[1]}
+		}
+		return nil
+	}
+	// "邀请人"邀请"新成员1、新成员2"加入了群聊
+	i := strings.Index(content, "邀请")
+	if i < 0 {
+		return nil
+	}
+	match := joinNamePattern.FindStringSubmatch(content[i:])
+	if match == nil {
+		return nil
+	}
+	return strings.Split(match[1], "、")
+}
+
+// Welcome 记录新成员，等待同一批成员入群后合并发送欢迎，返回去重后的新成员
+func (m *WelcomeManager) Welcome(gid string, groupName string, names []string) []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	// 未设置欢迎的群不会发送，入群时清理，避免记录一直增长
+	m.evict()
+	batch, ok := m.pending[gid]
+	if !ok {
+		batch = &welcomeBatch{groupName: groupName}
+	}
+	accepted := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		key := gid + "\x00" + name
+		if name == "" || time.Since(m.welcomed[key]) < welcomeDedupWindow {
+			continue
+		}
+		m.welcomed[key] = time.Now()
+		batch.names = append(batch.names, name)
+		accepted = append(accepted, name)
+	}
+	if len(batch.names) == 0 || ok {
+		return accepted
+	}
+	m.pending[gid] = batch
+	batch.timer = time.AfterFunc(welcomeBatchDelay, func() { m.flush(gid) })
+	return accepted
+}
+
+// flush 发送群内等待的欢迎，冷却中时延迟到冷却结束
+func (m *WelcomeManager) flush(gid string) {
+	m.mutex.Lock()
+	batch, ok := m.pending[gid]
+	if !ok {
+		m.mutex.Unlock()
+		return
+	}
+	setting := new(WelcomeSetting)
+	if err := m.DB.Take(setting, "enabled = ? and (setting = ? or setting = ?)", true, gid, batch.groupName).Error; err != nil {
+		delete(m.pending, gid)
+		m.mutex.Unlock()
+		return
+	}
+	cooldown := time.Duration(setting.Cooldown) * time.Second
+	if remain := cooldown - time.Since(m.lastSent[gid]); remain > 0 {
+		batch.timer = time.AfterFunc(remain, func() { m.flush(gid) })
+		m.mutex.Unlock()
+		return
+	}
+	delete(m.pending, gid)
+	m.lastSent[gid] = time.Now()
+	m.mutex.Unlock()
+
+	if err := m.send(gid, batch.groupName, *setting, batch.names); err != nil {
+		log.Println("发送入群欢迎失败", gid, err)
+	}
+}
+
+// evict 清理过期的已欢迎成员，需持有锁
+func (m *WelcomeManager) evict() {
+	for key, t := range m.welcomed {
+		if time.Since(t) >= welcomeDedupWindow {
+			delete(m.welcomed, key)
+		}
+	}
+}
+
+func (m *WelcomeManager) send(gid string, groupName string, setting WelcomeSetting, names []string) (err error) {
+	template := setting.Template
+	if template == "" {
+		template = defaultWelcome
+	}
+	mentions := make([]string, 0, len(names))
+	for _, name := range names {
+		mentions = append(mentions, "@"+name+"\u2005")
+	}
+	text := strings.NewReplacer(
+		"{names}", strings.Join(mentions, ""),
+		"{group}", groupName,
+		"{count}", strconv.Itoa(len(names)),
+		"{time}", time.Now().Format(time.DateTime),
+	).Replace(template)
+	if _, err = m.Sender.SendGroupTextMsgByGid(gid, text); err != nil {
+		return err
+	}
+	if setting.Image != "" {
+		_, err = m.Sender.SendGroupMediaMsgByGid(gid, 2, setting.Image, "", "")
+	}
+	return err
+}
+
+// List 查询入群欢迎设置
+func (m *WelcomeManager) List() ([]WelcomeSetting, error) {
+	var settings []WelcomeSetting
+	err := m.DB.Order("id").Find(&settings).Error
+	return settings, err
+}
+
+// Save 新增或更新入群欢迎设置
+func (m *WelcomeManager) Save(setting *WelcomeSetting) error {
+	if setting.Setting == "" {
+		return errors.New("群id或群名称不能为空")
+	}
+	if setting.Cooldown < 0 {
+		return errors.New("冷却时长不能小于0")
+	}
+	setting.Time = time.Now().Unix()
+	return m.DB.Save(setting).Error
+}
+
+// Delete 删除入群欢迎设置
+func (m *WelcomeManager) Delete(id uint) (bool, error) {
+	res := m.DB.Delete(&WelcomeSetting{}, "id = ?", id)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (m *WelcomeManager) HandleManage(content string, ctx *openwechat.MessageContext) (ok bool, err error) {
+	subCommands := strings.SplitN(content, " ", 3)
+	if len(subCommands) < 2 {
+		return
+	}
+	if !m.Admin.Verify(ctx, subCommands[0]) {
+		return
+	}
+	sender, err := ctx.Sender()
+	if err != nil {
+		return false, err
+	}
+	commands := subCommands[1:]
+	setting := new(WelcomeSetting)
+	if err := m.DB.Take(setting, "setting = ? or setting = ?", sender.UserName, sender.NickName).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, errors.New("查询入群欢迎出错")
+		}
+		setting = &WelcomeSetting{Setting: sender.NickName, Template: defaultWelcome}
+	}
+	var param string
+	if len(commands) > 1 {
+		param = strings.TrimSpace(commands[1])
+	}
+	switch commands[0] {
+	case "show":
+		if setting.ID == 0 {
+			_, _ = ctx.ReplyText("当前群未设置入群欢迎")
+		} else {
+			_, _ = ctx.ReplyText(setting.String())
+		}
+		return true, nil
+	case "set":
+		// set 欢迎语
+		if param == "" {
+			return false, errors.New("命令格式错误:请输入欢迎语")
+		}
+		setting.Template = param
+		setting.Enabled = true
+	case "image":
+		// image 图片地址，clear清除
+		if param == "" {
+			return false, errors.New("命令格式错误:请输入图片地址")
+		}
+		if param == "clear" {
+			param = ""
+		}
+		setting.Image = param
+	case "cooldown":
+		if setting.Cooldown, err = strconv.ParseInt(param, 10, 64); err != nil {
+			return false, errors.New("命令格式错误:冷却时长错误")
+		}
+	case "enable":
+		setting.Enabled = true
+	case "disable":
+		setting.Enabled = false
+	case "del":
+		if setting.ID == 0 {
+			_, _ = ctx.ReplyText("当前群未设置入群欢迎")
+			return true, nil
+		}
+		if _, err := m.Delete(setting.ID); err != nil {
+			return false, errors.New("删除入群欢迎出错")
+		}
+		_, _ = ctx.ReplyText("已删除入群欢迎")
+		return true, nil
+	default:
+		return false, nil
+	}
+	if err := m.Save(setting); err != nil {
+		return false, errors.New("保存入群欢迎出错:" + err.Error())
+	}
+	_, _ = ctx.ReplyText("已更新入群欢迎 " + setting.String())
+	return true, nil
+}
@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseJoinNames(t *testing.T) {
+	cases := []struct {
+		content string
+		want    []string
+	}{
+		{`"张三"邀请"李四、王五"加入了群聊`, []string{"李四", "王五"}},
+		{`你邀请"李四"加入了群聊`, []string{"李四"}},
+		{`"李四"通过扫描"张三"分享的二维码加入群聊`, []string{"李四"}},
+		{`"张三"修改群名为"新群名"`, nil},
+		{`邀请加入了群聊`, nil},
+	}
+	for _, c := range cases {
+		if got := ParseJoinNames(c.content); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: 期望%v, 实际%v", c.content, c.want, got)
+		}
+	}
+}
+
+func TestWelcomeBatch(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&WelcomeSetting{}); err != nil {
+		t.Fatal(err)
+	}
+	m := &WelcomeManager{DB: db}
+	m.BeanConstruct()
+
+	if joined := m.Welcome("@@group", "测试群", []string{"张三", " 李四 ", ""}); !reflect.DeepEqual(joined, []string{"张三", "李四"}) {
+		t.Fatalf("期望张三、李四, 实际%v", joined)
+	}
+	// 同一批入群的成员合并发送，重复的成员不再欢迎
+	if joined := m.Welcome("@@group", "测试群", []string{"李四", "王五"}); !reflect.DeepEqual(joined, []string{"王五"}) {
+		t.Fatalf("期望王五, 实际%v", joined)
+	}
+	batch := m.pending["@@group"]
+	if batch == nil || !reflect.DeepEqual(batch.names, []string{"张三", "李四", "王五"}) {
+		t.Fatalf("期望合并为一批, 实际%v", batch)
+	}
+	batch.timer.Stop()
+	if joined := m.Welcome("@@other", "其他群", []string{"张三"}); len(joined) != 1 {
+		t.Fatal("不同群的成员分别欢迎")
+	}
+	m.pending["@@other"].timer.Stop()
+
+	// 冷却中的群延迟发送
+	if err := m.Save(&WelcomeSetting{Setting: "测试群", Cooldown: 60, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	m.lastSent["@@group"] = time.Now()
+	m.flush("@@group")
+	if batch := m.pending["@@group"]; batch == nil {
+		t.Fatal("冷却中不应发送欢迎")
+	} else {
+		batch.timer.Stop()
+	}
+	// 未设置欢迎的群直接丢弃
+	m.flush("@@other")
+	if _, ok := m.pending["@@other"]; ok {
+		t.Fatal("未设置欢迎的群不应保留等待发送的欢迎")
+	}
+	if joined := m.Welcome("@@other", "其他群", []string{"张三"}); len(joined) != 0 {
+		t.Fatal("已欢迎的成员在去重时间内不应再次欢迎")
+	}
+	// 过期的欢迎记录在其他成员入群时清理
+	m.welcomed["@@expired\x00赵六"] = time.Now().Add(-welcomeDedupWindow)
+	m.Welcome("@@new", "新群", []string{"孙七"})
+	m.pending["@@new"].timer.Stop()
+	if _, ok := m.welcomed["@@expired\x00赵六"]; ok {
+		t.Fatal("过期的欢迎记录应被清理")
+	}
+}
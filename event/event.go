@@ -0,0 +1,44 @@
+package event
+
+// 事件类型
+const (
+	MemberJoined    = "member_joined"    // 新成员入群
+	MemberLeft      = "member_left"      // 成员退群或被移出群聊
+	MessageRecalled = "message_recalled" // 群消息被撤回
+	GroupRenamed    = "group_renamed"    // 群名称修改
+	Login           = "login"            // 机器人登录
+	Logout          = "logout"           // 机器人退出登录
+	DayRollover     = "day_rollover"     // 日期切换
+)
+
+// Types 所有可订阅的事件类型
+var Types = []string{MemberJoined, MemberLeft, MessageRecalled, GroupRenamed, Login, Logout, DayRollover}
+
+// Event 插件订阅的事件，不同类型的事件只填充相关字段
+type Event struct {
+	Type      string   `json:"type"`
+	GID       string   `json:"gid,omitempty"`       // 群id,群事件时填充
+	GroupName string   `json:"groupName,omitempty"` // 群名称,群改名时为新名称
+	OldName   string   `json:"oldName,omitempty"`   // 群改名前的名称
+	Names     []string `json:"names,omitempty"`     // 入群或退群的成员名称
+	UID       string   `json:"uid,omitempty"`       // 撤回消息的成员id
+	Username  string   `json:"username,omitempty"`  // 撤回消息的成员名称
+	MsgID     string   `json:"msgId,omitempty"`     // 被撤回的消息id
+	Content   string   `json:"content,omitempty"`   // 被撤回的消息内容,未记录时为空
+	Time      int64    `json:"time"`
+}
+
+// Valid 检查事件类型是否有效
+func Valid(eventType string) bool {
+	for _, t := range Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGroup 是否为群事件，群事件只发送给在该群可用的插件
+func (e Event) IsGroup() bool {
+	return e.GID != ""
+}
@@ -0,0 +1,154 @@
+package interpreter
+
+import (
+	"fmt"
+	"github.com/traefik/yaegi/stdlib"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 插件权限
+const (
+	CapNetwork    = "network"    // 网络访问
+	CapFilesystem = "filesystem" // 文件和环境变量
+	CapExec       = "exec"       // 执行外部命令、系统调用和反射
+	CapDB         = "db"         // 数据库
+	CapDI         = "di"         // 依赖注入容器
+)
+
+// capabilityDirective 插件在代码注释中声明权限，例如 //plugin:capabilities network,db
+const capabilityDirective = "//plugin:capabilities"
+
+// Capabilities 所有可声明的权限
+var Capabilities = []string{CapNetwork, CapFilesystem, CapExec, CapDB, CapDI}
+
+// capabilityImports 需要权限才能导入的包，按前缀匹配
+var capabilityImports = map[string][]string{
+	CapNetwork:    {"net", "crypto/tls", "log/syslog", "expvar", "github.com/go-resty/resty"},
+	CapFilesystem: {"os", "io/ioutil", "path/filepath"},
+	CapExec:       {"os/exec", "os/signal", "syscall", "reflect", "unsafe", "github.com/traefik/yaegi"},
+	CapDI:         {"github.com/cheivin/di"},
+}
+
+// CapabilityOf 导入包需要的权限，不需要权限时返回空
+func CapabilityOf(importPath string) string {
+	matched, length := "", 0
+	for capability, prefixes := range capabilityImports {
+		for _, prefix := range prefixes {
+			if (importPath == prefix || strings.HasPrefix(importPath, prefix+"/")) && len(prefix) > length {
+				matched, length = capability, len(prefix)
+			}
+		}
+	}
+	return matched
+}
+
+// ParseCapabilities 解析代码中声明的权限
+func ParseCapabilities(code string) ([]string, error) {
+	set := map[string]bool{}
+	for _, line := range strings.Split(code, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, capabilityDirective) {
+			continue
+		}
+		for _, capability := range strings.FieldsFunc(strings.TrimPrefix(line, capabilityDirective), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		}) {
+			if !ValidCapability(capability) {
+				return nil, fmt.Errorf("未知的插件权限:%s", capability)
+			}
+			set[capability] = true
+		}
+	}
+	capabilities := make([]string, 0, len(set))
+	for capability := range set {
+		capabilities = append(capabilities, capability)
+	}
+	sort.Strings(capabilities)
+	return capabilities, nil
+}
+
+// ValidCapability 检查权限名称是否有效
+func ValidCapability(capability string) bool {
+	for _, c := range Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCapability 检查权限列表中是否包含指定权限
+func HasCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportCapabilities 代码导入的包需要的权限
+func ImportCapabilities(code string) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", code, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	set := map[string]bool{}
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		if capability := CapabilityOf(importPath); capability != "" {
+			set[capability] = true
+		}
+	}
+	capabilities := make([]string, 0, len(set))
+	for capability := range set {
+		capabilities = append(capabilities, capability)
+	}
+	sort.Strings(capabilities)
+	return capabilities, nil
+}
+
+// DeclareCapabilities 在代码开头添加权限声明
+func DeclareCapabilities(code string, capabilities []string) string {
+	return capabilityDirective + " " + strings.Join(capabilities, ",") + "\n" + code
+}
+
+// checkImports 检查代码导入的包是否都已授权
+func checkImports(code string, granted []string) error {
+	file, err := parser.ParseFile(token.NewFileSet(), "", code, parser.ImportsOnly)
+	if err != nil {
+		return err
+	}
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		if capability := CapabilityOf(importPath); capability != "" && !HasCapability(granted, capability) {
+			return fmt.Errorf("导入%s需要%s权限", importPath, capability)
+		}
+	}
+	return nil
+}
+
+// grantedSymbols 按权限过滤的符号表，符号表的key为 导入路径/包名
+func grantedSymbols(symbols map[string]map[string]reflect.Value, granted []string) map[string]map[string]reflect.Value {
+	filtered := make(map[string]map[string]reflect.Value, len(symbols))
+	for key, values := range symbols {
+		importPath := key
+		if i := strings.LastIndex(key, "/"); i > 0 {
+			importPath = key[:i]
+		}
+		if capability := CapabilityOf(importPath); capability == "" || HasCapability(granted, capability) {
+			filtered[key] = values
+		}
+	}
+	return filtered
+}
+
+// stdSymbols 按权限过滤的标准库符号
+func stdSymbols(granted []string) map[string]map[string]reflect.Value {
+	return grantedSymbols(stdlib.Symbols, granted)
+}
@@ -0,0 +1,69 @@
+package interpreter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCapabilityOf(t *testing.T) {
+	cases := map[string]string{
+		"strings":                         "",
+		"net/http":                        CapNetwork,
+		"os":                              CapFilesystem,
+		"os/exec":                         CapExec,
+		"path/filepath":                   CapFilesystem,
+		"github.com/go-resty/resty/v2":    CapNetwork,
+		"github.com/cheivin/di":           CapDI,
+		"gorm.io/gorm":                    "",
+		"github.com/traefik/yaegi/interp": CapExec,
+		"reflect":                         CapExec,
+		"unsafe":                          CapExec,
+	}
+	for importPath, want := range cases {
+		if got := CapabilityOf(importPath); got != want {
+			t.Errorf("%s: got %q, want %q", importPath, got, want)
+		}
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	capabilities, err := ParseCapabilities("package demo\n//plugin:capabilities network, db\n//plugin:capabilities network\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(capabilities, []string{CapDB, CapNetwork}) {
+		t.Fatalf("unexpected capabilities %v", capabilities)
+	}
+	if _, err := ParseCapabilities("//plugin:capabilities root"); err == nil {
+		t.Fatal("unknown capability should fail")
+	}
+}
+
+func TestNewCodeCapabilities(t *testing.T) {
+	code := "package demo\n\nimport \"os\"\n\nfunc Env() string { return os.Getenv(\"HOME\") }\n"
+	if _, err := NewCode("demo", code); err == nil {
+		t.Fatal("import without capability should fail")
+	}
+	c, err := NewCode("demo", code, CapFilesystem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn, err := FindMethod[func() string](c, "Env"); err != nil || fn == nil {
+		t.Fatal("method not found", err)
+	}
+}
+
+func TestImportCapabilities(t *testing.T) {
+	code := "package demo\n\nimport (\n\t\"net/http\"\n\t\"os\"\n\t\"strings\"\n)\n"
+	capabilities, err := ImportCapabilities(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(capabilities, []string{CapFilesystem, CapNetwork}) {
+		t.Fatalf("unexpected capabilities %v", capabilities)
+	}
+	declared, err := ParseCapabilities(DeclareCapabilities(code, capabilities))
+	if err != nil || !reflect.DeepEqual(declared, capabilities) {
+		t.Fatalf("unexpected declared capabilities %v %v", declared, err)
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"github.com/eatmoreapple/openwechat"
 	"github.com/go-resty/resty/v2"
 	"github.com/traefik/yaegi/interp"
-	"github.com/traefik/yaegi/stdlib"
+	"github.com/traefik/yaegi/stdlib/unrestricted"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"io"
@@ -14,7 +14,11 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"wechat-assistant/event"
+	"wechat-assistant/job"
+	"wechat-assistant/kv"
 	"wechat-assistant/lock"
+	"wechat-assistant/session"
 )
 
 type Code struct {
@@ -22,11 +26,14 @@ type Code struct {
 	interpreter *interp.Interpreter `gorm:"-"`
 }
 
-// newInterpreter 代码解释器
-func newInterpreter() *interp.Interpreter {
+// newInterpreter 代码解释器，只加载已授权权限对应的符号
+func newInterpreter(granted []string) *interp.Interpreter {
 	interpreter := interp.New(interp.Options{}) // 初始化一个 yaegi 解释器
-	_ = interpreter.Use(stdlib.Symbols)         // 容许脚本调用（简直）所有的 Go 官网 package 代码
-	_ = interpreter.Use(map[string]map[string]reflect.Value{
+	_ = interpreter.Use(stdSymbols(granted))    // 标准库中需要权限的包只在授权后加载
+	if HasCapability(granted, CapExec) {
+		_ = interpreter.Use(unrestricted.Symbols)
+	}
+	_ = interpreter.Use(grantedSymbols(map[string]map[string]reflect.Value{
 		"github.com/eatmoreapple/openwechat/openwechat": {
 			"MessageContext": reflect.ValueOf((*openwechat.MessageContext)(nil)),
 			"Bot":            reflect.ValueOf((*openwechat.Bot)(nil)),
@@ -70,7 +77,26 @@ func newInterpreter() *interp.Interpreter {
 		"wechat-assistant/lock/lock": {
 			"Locker": reflect.ValueOf((*lock.Locker)(nil)),
 		},
-	})
+		"wechat-assistant/event/event": {
+			"Event":           reflect.ValueOf((*event.Event)(nil)),
+			"MemberJoined":    reflect.ValueOf(event.MemberJoined),
+			"MemberLeft":      reflect.ValueOf(event.MemberLeft),
+			"MessageRecalled": reflect.ValueOf(event.MessageRecalled),
+			"GroupRenamed":    reflect.ValueOf(event.GroupRenamed),
+			"Login":           reflect.ValueOf(event.Login),
+			"Logout":          reflect.ValueOf(event.Logout),
+			"DayRollover":     reflect.ValueOf(event.DayRollover),
+		},
+		"wechat-assistant/job/job": {
+			"Job": reflect.ValueOf((*job.Job)(nil)),
+		},
+		"wechat-assistant/kv/kv": {
+			"Store": reflect.ValueOf((*kv.Store)(nil)),
+		},
+		"wechat-assistant/session/session": {
+			"Session": reflect.ValueOf((*session.Session)(nil)),
+		},
+	}, granted))
 	return interpreter
 }
 
@@ -110,8 +136,12 @@ func getPackageName(code string) string {
 	return packageName
 }
 
-func NewCode(packageName string, code string) (*Code, error) {
-	interpreter := newInterpreter()
+// NewCode 加载代码，granted为已授权的权限，导入未授权的包时返回错误
+func NewCode(packageName string, code string, granted ...string) (*Code, error) {
+	if err := checkImports(code, granted); err != nil {
+		return nil, err
+	}
+	interpreter := newInterpreter(granted)
 	// 加载
 	if _, err := interpreter.Eval(code); err != nil {
 		return nil, err
@@ -0,0 +1,10 @@
+package job
+
+import "gorm.io/gorm"
+
+// Job 插件声明的定时任务，插件绑定后注册，销毁时注销
+type Job struct {
+	Name string                  // 任务名称，插件内唯一
+	Spec string                  // cron表达式，支持秒级表达式和@every等描述符
+	Run  func(db *gorm.DB) error // 执行方法，多实例部署时只在一个实例上执行
+}
@@ -0,0 +1,19 @@
+package kv
+
+import "time"
+
+// Store 插件键值存储，数据按插件隔离，可进一步限定到当前群或当前用户
+type Store interface {
+	// Get 获取未过期的值
+	Get(key string) (string, bool, error)
+	// Set 设置值，ttl为0时不过期
+	Set(key string, value string, ttl time.Duration) error
+	// Delete 删除值
+	Delete(key string) error
+	// List 按前缀查询未过期的键值
+	List(prefix string) (map[string]string, error)
+	// Group 限定到当前群的存储
+	Group() Store
+	// User 限定到当前群中当前用户的存储
+	User() Store
+}
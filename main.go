@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+	"wechat-assistant/admin"
 	"wechat-assistant/bot"
 	"wechat-assistant/database"
 	"wechat-assistant/lock"
@@ -33,10 +34,16 @@ func init() {
 			"port": GetOrDefault(os.Getenv("APP_PORT"), "8080"),
 		},
 		"bot": map[string]interface{}{
-			"data":   filepath.Join(os.Getenv("DATA"), "storage.json"),
-			"secret": GetOrDefault(os.Getenv("SECRET"), "MZXW6YTBOI======"),
-			"files":  GetOrDefault(os.Getenv("DATA_FILES"), filepath.Join(os.Getenv("DATA"), "files")),
-			"cache":  GetOrDefault(os.Getenv("DATA_CACHE"), filepath.Join(os.Getenv("DATA"), "cache")),
+			"data":       filepath.Join(os.Getenv("DATA"), "storage.json"),
+			"secret":     GetOrDefault(os.Getenv("SECRET"), "MZXW6YTBOI======"),
+			"files":      GetOrDefault(os.Getenv("DATA_FILES"), filepath.Join(os.Getenv("DATA"), "files")),
+			"cache":      GetOrDefault(os.Getenv("DATA_CACHE"), filepath.Join(os.Getenv("DATA"), "cache")),
+			"workers":    GetOrDefault(os.Getenv("BOT_WORKERS"), "8"),
+			"queue":      GetOrDefault(os.Getenv("BOT_QUEUE"), "1000"),
+			"groupQueue": GetOrDefault(os.Getenv("BOT_GROUP_QUEUE"), "100"),
+		},
+		"plugin": map[string]interface{}{
+			"secret": os.Getenv("PLUGIN_SECRET"),
 		},
 		"db": map[string]interface{}{
 			"type":       os.Getenv("DB"),
@@ -54,6 +61,10 @@ func init() {
 			"password": os.Getenv("MQTT_PASSWORD"),
 			"prefix":   os.Getenv("MQTT_PREFIX"),
 		},
+		"moderation": map[string]interface{}{
+			"words":   os.Getenv("MODERATION_WORDS"),
+			"actions": GetOrDefault(os.Getenv("MODERATION_ACTIONS"), "record"),
+		},
 		"s3": map[string]interface{}{
 			"endpoint":   os.Getenv("S3_ENDPOINT"),
 			"region":     os.Getenv("S3_REGION"),
@@ -125,8 +136,15 @@ func main() {
 	}
 
 	container.Provide(lock.DBLocker{}).
+		Provide(admin.Manager{}).
 		Provide(plugin.Manager{}).
 		Provide(bot.KeywordForbiddenManager{}).
+		Provide(bot.QuotaManager{}).
+		Provide(bot.ModerationManager{}).
+		Provide(bot.AutoReplyManager{}).
+		Provide(bot.ScheduleManager{}).
+		Provide(bot.ReminderManager{}).
+		Provide(bot.WelcomeManager{}).
 		Provide(bot.MsgHandler{}).
 		Provide(redirect.MsgSender{}).
 		Provide(bot.Manager{}).
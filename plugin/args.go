@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	ArgTypeString = "string" // 单个词
+	ArgTypeInt    = "int"    // 整数
+	ArgTypeNumber = "number" // 数字
+	ArgTypeText   = "text"   // 剩余全部内容，只能作为最后一个参数
+)
+
+// Arg 插件参数定义
+type Arg struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+}
+
+// ParseArgs 解析json格式的参数定义
+func ParseArgs(schema string) ([]Arg, error) {
+	if strings.TrimSpace(schema) == "" {
+		return nil, nil
+	}
+	var args []Arg
+	if err := json.Unmarshal([]byte(schema), &args); err != nil {
+		return nil, errors.New("参数定义格式错误:" + err.Error())
+	}
+	return args, nil
+}
+
+// ValidateArgs 按参数定义校验插件参数，参数以空白分隔并按位置匹配
+func ValidateArgs(args []Arg, params []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	fields := strings.Fields(strings.Join(params, " "))
+	for i, arg := range args {
+		if i >= len(fields) {
+			if arg.Required {
+				return fmt.Errorf("缺少参数:%s", arg.Name)
+			}
+			continue
+		}
+		value := fields[i]
+		switch arg.Type {
+		case ArgTypeInt:
+			if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+				return fmt.Errorf("参数%s必须为整数", arg.Name)
+			}
+		case ArgTypeNumber:
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("参数%s必须为数字", arg.Name)
+			}
+		case ArgTypeText:
+			return nil
+		}
+		if len(arg.Enum) > 0 {
+			matched := false
+			for _, e := range arg.Enum {
+				if e == value {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("参数%s可选值为:%s", arg.Name, strings.Join(arg.Enum, "/"))
+			}
+		}
+	}
+	if len(fields) > len(args) {
+		return fmt.Errorf("参数过多，最多%d个", len(args))
+	}
+	return nil
+}
+
+// Help 生成插件详细帮助
+func (info Info) Help(keyword string) string {
+	msg := fmt.Sprintf("[%s]:%s\n", keyword, info.Description)
+	if info.Usage != "" {
+		msg += "用法:" + info.Usage + "\n"
+	} else if len(info.Args) > 0 {
+		usage := "#" + keyword
+		for _, arg := range info.Args {
+			if arg.Required {
+				usage += " <" + arg.Name + ">"
+			} else {
+				usage += " [" + arg.Name + "]"
+			}
+		}
+		msg += "用法:" + usage + "\n"
+	}
+	if len(info.Args) > 0 {
+		msg += "参数:\n"
+		for _, arg := range info.Args {
+			msg += "--" + arg.Name
+			if arg.Type != "" {
+				msg += "(" + arg.Type + ")"
+			}
+			if arg.Description != "" {
+				msg += ":" + arg.Description
+			}
+			if len(arg.Enum) > 0 {
+				msg += " 可选:" + strings.Join(arg.Enum, "/")
+			}
+			msg += "\n"
+		}
+	}
+	if len(info.Examples) > 0 {
+		msg += "示例:\n" + strings.Join(info.Examples, "\n") + "\n"
+	}
+	return msg
+}
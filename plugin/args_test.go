@@ -0,0 +1,27 @@
+package plugin
+
+import "testing"
+
+func TestValidateArgs(t *testing.T) {
+	args, err := ParseArgs(`[{"name":"城市","required":true},{"name":"天数","type":"int","enum":["1","3","7"]}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		params []string
+		valid  bool
+	}{
+		{[]string{"杭州"}, true},
+		{[]string{"杭州 3"}, true},
+		{[]string{}, false},
+		{[]string{"杭州 a"}, false},
+		{[]string{"杭州 5"}, false},
+		{[]string{"杭州 3 多余"}, false},
+	}
+	for _, c := range cases {
+		if err := ValidateArgs(args, c.params); (err == nil) != c.valid {
+			t.Errorf("%v: 期望%v, 实际%v", c.params, c.valid, err)
+		}
+	}
+	t.Log(Info{Description: "天气查询", Args: args}.Help("天气"))
+}
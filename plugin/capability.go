@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"log"
+	"strings"
+	"time"
+	"wechat-assistant/interpreter"
+	"wechat-assistant/lock"
+)
+
+// CapabilityError 插件声明的权限未授权
+type CapabilityError struct {
+	Missing []string
+}
+
+func (e *CapabilityError) Error() string {
+	return "插件需要授权以下权限:" + strings.Join(e.Missing, ",")
+}
+
+// missingCapabilities 声明但未授权的权限
+func missingCapabilities(declared []string, granted []string) []string {
+	var missing []string
+	for _, capability := range declared {
+		if !interpreter.HasCapability(granted, capability) {
+			missing = append(missing, capability)
+		}
+	}
+	return missing
+}
+
+// parseGrant 解析管理命令中的授权参数，格式为 grant 权限1,权限2
+func parseGrant(params []string) []string {
+	if len(params) < 2 || params[0] != "grant" {
+		return nil
+	}
+	return strings.Split(params[1], ",")
+}
+
+// migrateCapabilities 权限控制之前安装的插件没有声明权限，按导入的包补充权限声明，避免升级后无法加载。
+// 新安装的插件导入未声明权限的包时无法安装，已声明权限的插件不会重复处理
+func (m *Manager) migrateCapabilities() error {
+	var addons []Addon
+	if err := m.DB.Find(&addons).Error; err != nil {
+		return err
+	}
+	for _, addon := range addons {
+		if strings.HasPrefix(addon.Code, "http") {
+			continue
+		}
+		declared, err := interpreter.ParseCapabilities(addon.Code)
+		if err != nil || len(declared) > 0 {
+			continue
+		}
+		required, err := interpreter.ImportCapabilities(addon.Code)
+		if err != nil || len(required) == 0 {
+			continue
+		}
+		addon.Code = interpreter.DeclareCapabilities(addon.Code, required)
+		addon.Capabilities = required
+		if err := m.DB.Model(&addon).Select("code", "capabilities").Updates(&addon).Error; err != nil {
+			return err
+		}
+		log.Println("已为插件补充权限声明", addon.ID, strings.Join(required, ","))
+	}
+	return nil
+}
+
+// pluginLocker 提供给插件的分布式锁，只暴露加锁方法，避免插件通过锁的实现取得数据库连接
+type pluginLocker struct {
+	locker lock.Locker
+}
+
+func (l pluginLocker) Lock(key string, ttl time.Duration) (int, error) {
+	return l.locker.Lock(key, ttl)
+}
+
+func (l pluginLocker) Update(key string, ttl time.Duration) {
+	l.locker.Update(key, ttl)
+}
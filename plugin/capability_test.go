@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"reflect"
+	"testing"
+	"wechat-assistant/interpreter"
+)
+
+func TestMigrateCapabilities(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Addon{}, &AddonBind{}); err != nil {
+		t.Fatal(err)
+	}
+	// 权限控制之前安装的插件，没有权限声明
+	legacy := Addon{Info: Info{ID: "legacy", Package: "legacy", Code: `package legacy
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+func Info() (string, string) {
+	return "状态", "查询状态"
+}
+
+func Handle(db *gorm.DB, ctx *openwechat.MessageContext) (bool, error) {
+	return http.StatusOK == 200, nil
+}
+`}}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&AddonBind{ID: "legacy", Keyword: "状态"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{DB: db}
+	m.BeanConstruct(nil)
+	if err := m.migrateCapabilities(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.init(); err != nil {
+		t.Fatalf("升级后应能加载未声明权限的插件 %v", err)
+	}
+	plugin := m.loaded["legacy"]
+	if plugin == nil || !reflect.DeepEqual(plugin.Info().Capabilities, []string{interpreter.CapNetwork}) {
+		t.Fatalf("权限补充错误 %v", plugin)
+	}
+	addon := new(Addon)
+	db.Take(addon, "id = ?", "legacy")
+	if !reflect.DeepEqual(addon.Capabilities, []string{interpreter.CapNetwork}) {
+		t.Fatalf("权限未保存 %v", addon.Capabilities)
+	}
+	// 已声明权限的插件不再处理
+	code := addon.Code
+	if err := m.migrateCapabilities(); err != nil {
+		t.Fatal(err)
+	}
+	db.Take(addon, "id = ?", "legacy")
+	if addon.Code != code {
+		t.Fatal("不应重复补充权限声明")
+	}
+}
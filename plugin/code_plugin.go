@@ -8,7 +8,9 @@ import (
 	"gorm.io/gorm"
 	"log"
 	"runtime"
+	"wechat-assistant/event"
 	"wechat-assistant/interpreter"
+	"wechat-assistant/job"
 )
 
 type CodePlugin struct {
@@ -17,6 +19,9 @@ type CodePlugin struct {
 	fn          func(db *gorm.DB, ctx *openwechat.MessageContext) (bool, error) `gorm:"-"` // 执行
 	initFn      func(*gorm.DB) error                                            `gorm:"-"` // 初始方法
 	destroyFn   func(*gorm.DB) error                                            `gorm:"-"` // 销毁方法
+	onMessageFn func(db *gorm.DB, ctx *openwechat.MessageContext) (bool, error) `gorm:"-"` // 订阅消息
+	jobs        []job.Job                                                       `gorm:"-"` // 定时任务
+	onEventFn   func(db *gorm.DB, e event.Event) error                          `gorm:"-"` // 订阅事件
 }
 
 func (p *CodePlugin) Info() Info {
@@ -47,35 +52,80 @@ func (p *CodePlugin) HashCode() string {
 	return fmt.Sprintf("%x\n", md5.Sum([]byte(p.info.Code)))
 }
 
+// database 未授权数据库权限的插件不传入数据库连接
+func (p *CodePlugin) database(db *gorm.DB) *gorm.DB {
+	if interpreter.HasCapability(p.info.Capabilities, interpreter.CapDB) {
+		return db
+	}
+	return nil
+}
+
 func (p *CodePlugin) Init(db *gorm.DB) error {
 	if p.initFn != nil {
-		return p.initFn(db)
+		return p.initFn(p.database(db))
 	}
 	return nil
 }
 
 func (p *CodePlugin) Destroy(db *gorm.DB) error {
 	if p.destroyFn != nil {
-		return p.destroyFn(db)
+		return p.destroyFn(p.database(db))
 	}
 	return nil
 }
 
 func (p *CodePlugin) Handle(db *gorm.DB, ctx *openwechat.MessageContext) (bool, error) {
-	return p.fn(db, ctx)
+	return p.fn(p.database(db), ctx)
 }
 
-func NewCodePlugin(packageName string, codeStr string) (Plugin, error) {
-	// 加载
-	code, err := interpreter.NewCode(packageName, codeStr)
+// OnMessage 接收群内所有消息，插件未实现OnMessage时不处理
+func (p *CodePlugin) OnMessage(db *gorm.DB, ctx *openwechat.MessageContext) (bool, error) {
+	if p.onMessageFn == nil {
+		return false, nil
+	}
+	return p.onMessageFn(p.database(db), ctx)
+}
+
+// OnEvent 处理订阅的事件
+func (p *CodePlugin) OnEvent(db *gorm.DB, e event.Event) error {
+	if p.onEventFn == nil {
+		return nil
+	}
+	return p.onEventFn(p.database(db), e)
+}
+
+// Jobs 插件声明的定时任务，执行时按权限传入数据库
+func (p *CodePlugin) Jobs() []job.Job {
+	jobs := make([]job.Job, 0, len(p.jobs))
+	for _, j := range p.jobs {
+		run := j.Run
+		jobs = append(jobs, job.Job{Name: j.Name, Spec: j.Spec, Run: func(db *gorm.DB) error {
+			return run(p.database(db))
+		}})
+	}
+	return jobs
+}
+
+// NewCodePlugin 加载代码插件，granted为已授权的权限，插件声明的权限未全部授权时返回CapabilityError
+func NewCodePlugin(packageName string, codeStr string, granted ...string) (Plugin, error) {
+	declared, err := interpreter.ParseCapabilities(codeStr)
+	if err != nil {
+		return nil, err
+	}
+	if missing := missingCapabilities(declared, granted); len(missing) > 0 {
+		return nil, &CapabilityError{Missing: missing}
+	}
+	// 加载，只开放插件声明的权限
+	code, err := interpreter.NewCode(packageName, codeStr, declared...)
 	if err != nil {
 		return nil, err
 	}
 	plugin := CodePlugin{
 		info: Info{
-			ID:      code.Package,
-			Package: code.Package,
-			Code:    codeStr,
+			ID:           code.Package,
+			Package:      code.Package,
+			Code:         codeStr,
+			Capabilities: declared,
 		},
 		interpreter: code,
 	}
@@ -83,6 +133,22 @@ func NewCodePlugin(packageName string, codeStr string) (Plugin, error) {
 	if infoFn, err := interpreter.FindMethod[func() (string, string)](code, "Info"); err == nil && infoFn != nil {
 		plugin.info.Keyword, plugin.info.Description = (*infoFn)()
 	}
+	// 用法和示例
+	if usageFn, err := interpreter.FindMethod[func() (string, []string)](code, "Usage"); err == nil && usageFn != nil {
+		plugin.info.Usage, plugin.info.Examples = (*usageFn)()
+	}
+	// 参数定义
+	if argsFn, err := interpreter.FindMethod[func() string](code, "Args"); err == nil && argsFn != nil {
+		if plugin.info.Args, err = ParseArgs((*argsFn)()); err != nil {
+			return nil, err
+		}
+	}
+	// 配置定义
+	if configFn, err := interpreter.FindMethod[func() string](code, "Config"); err == nil && configFn != nil {
+		if plugin.info.Config, err = ParseConfigSchema((*configFn)()); err != nil {
+			return nil, err
+		}
+	}
 	// 目标方法
 	if handler, err := interpreter.FindMethod[func(db *gorm.DB, ctx *openwechat.MessageContext) (bool, error)](code, "Handle"); err != nil {
 		return nil, err
@@ -96,10 +162,35 @@ func NewCodePlugin(packageName string, codeStr string) (Plugin, error) {
 	if initFn, err := interpreter.FindMethod[func(*gorm.DB) error](code, "Init"); err == nil && initFn != nil {
 		plugin.initFn = *initFn
 	}
+	// 订阅消息
+	if onMessageFn, err := interpreter.FindMethod[func(db *gorm.DB, ctx *openwechat.MessageContext) (bool, error)](code, "OnMessage"); err == nil && onMessageFn != nil {
+		plugin.onMessageFn = *onMessageFn
+		plugin.info.Subscribe = true
+		if priorityFn, err := interpreter.FindMethod[func() int](code, "Priority"); err == nil && priorityFn != nil {
+			plugin.info.Priority = (*priorityFn)()
+		}
+	}
 	// 销毁方法
 	if destroyFn, err := interpreter.FindMethod[func(*gorm.DB) error](code, "Destroy"); err == nil && destroyFn != nil {
 		plugin.destroyFn = *destroyFn
 	}
+	// 订阅事件
+	if onEventFn, err := interpreter.FindMethod[func(*gorm.DB, event.Event) error](code, "OnEvent"); err == nil && onEventFn != nil {
+		plugin.onEventFn = *onEventFn
+		if eventsFn, err := interpreter.FindMethod[func() []string](code, "Events"); err == nil && eventsFn != nil {
+			plugin.info.Events = (*eventsFn)()
+		}
+		if err := validateEvents(plugin.info.Events); err != nil {
+			return nil, err
+		}
+	}
+	// 定时任务
+	if jobsFn, err := interpreter.FindMethod[func() []job.Job](code, "Jobs"); err == nil && jobsFn != nil {
+		plugin.jobs = (*jobsFn)()
+		if err := validateJobs(plugin.jobs); err != nil {
+			return nil, err
+		}
+	}
 
 	// 回收钩子
 	runtime.SetFinalizer(&plugin, func(pluginObj interface{}) {
@@ -109,6 +200,9 @@ func NewCodePlugin(packageName string, codeStr string) (Plugin, error) {
 		p.fn = nil
 		p.initFn = nil
 		p.destroyFn = nil
+		p.onMessageFn = nil
+		p.jobs = nil
+		p.onEventFn = nil
 	})
 
 	return &plugin, nil
@@ -0,0 +1,251 @@
+package plugin
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm/clause"
+	"io"
+	"strings"
+	"time"
+)
+
+// redacted 密钥配置在输出中的替代内容
+const redacted = "******"
+
+// ConfigField 插件配置项定义
+type ConfigField struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Secret      bool   `json:"secret,omitempty"`   // 密钥,加密保存且不在输出中显示
+	Required    bool   `json:"required,omitempty"` // 必填,未配置时插件无法调用
+	Default     string `json:"default,omitempty"`
+}
+
+// AddonConfig 插件配置值
+type AddonConfig struct {
+	AddonID string `gorm:"primaryKey;type:varchar(100)"` // 插件id
+	Key     string `gorm:"primaryKey;type:varchar(100)"` // 配置项
+	Value   string `gorm:"type:text"`                    // 配置值,密钥为加密后的内容
+	Secret  bool   ``                                    // 是否为密钥
+	Time    int64  `gorm:"type:int(13)"`
+}
+
+// ConfigValue 插件配置项及当前值，密钥的值已脱敏
+type ConfigValue struct {
+	ConfigField
+	Value      string `json:"value"`
+	Configured bool   `json:"configured"` // 是否已设置,未设置时使用默认值
+}
+
+func (v ConfigValue) String() string {
+	msg := v.Name
+	if v.Description != "" {
+		msg += "(" + v.Description + ")"
+	}
+	switch {
+	case v.Configured:
+		msg += ":" + v.Value
+	case v.Default != "":
+		msg += ":" + v.Default + "(默认)"
+	case v.Required:
+		msg += ":未设置(必填)"
+	default:
+		msg += ":未设置"
+	}
+	return msg
+}
+
+// ParseConfigSchema 解析json格式的配置定义
+func ParseConfigSchema(schema string) ([]ConfigField, error) {
+	if strings.TrimSpace(schema) == "" {
+		return nil, nil
+	}
+	var fields []ConfigField
+	if err := json.Unmarshal([]byte(schema), &fields); err != nil {
+		return nil, errors.New("配置定义格式错误:" + err.Error())
+	}
+	for _, field := range fields {
+		if field.Name == "" {
+			return nil, errors.New("配置定义格式错误:配置项名称不能为空")
+		}
+	}
+	return fields, nil
+}
+
+func findConfigField(fields []ConfigField, key string) (ConfigField, bool) {
+	for _, field := range fields {
+		if field.Name == key {
+			return field, true
+		}
+	}
+	return ConfigField{}, false
+}
+
+// configCipher 使用配置的密钥加解密插件密钥配置
+type configCipher struct {
+	secret string
+}
+
+func (c configCipher) aead() (cipher.AEAD, error) {
+	if c.secret == "" {
+		return nil, errors.New("未配置插件密钥PLUGIN_SECRET，无法保存密钥配置")
+	}
+	key := sha256.Sum256([]byte(c.secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c configCipher) encrypt(plain string) (string, error) {
+	aead, err := c.aead()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(plain), nil)), nil
+}
+
+func (c configCipher) decrypt(encrypted string) (string, error) {
+	aead, err := c.aead()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("密钥配置已损坏")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("密钥配置解密失败")
+	}
+	return string(plain), nil
+}
+
+// configSchema 已加载插件的配置定义
+func (m *Manager) configSchema(id string) ([]ConfigField, error) {
+	m.mutex.RLock()
+	plugin, ok := m.loaded[id]
+	m.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("插件%s未加载", id)
+	}
+	return plugin.Info().Config, nil
+}
+
+// SetConfig 设置插件配置，value为空时删除配置恢复默认值
+func (m *Manager) SetConfig(id string, key string, value string) error {
+	fields, err := m.configSchema(id)
+	if err != nil {
+		return err
+	}
+	field, ok := findConfigField(fields, key)
+	if !ok {
+		return fmt.Errorf("插件%s没有配置项%s", id, key)
+	}
+	if value == "" {
+		if err := m.DB.Delete(&AddonConfig{}, "addon_id = ? and `key` = ?", id, key).Error; err != nil {
+			return err
+		}
+	} else {
+		if field.Secret {
+			if value, err = m.cipher().encrypt(value); err != nil {
+				return err
+			}
+		}
+		if err := m.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&AddonConfig{
+			AddonID: id,
+			Key:     key,
+			Value:   value,
+			Secret:  field.Secret,
+			Time:    time.Now().Unix(),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	m.configMutex.Lock()
+	delete(m.configs, id)
+	m.configMutex.Unlock()
+	return nil
+}
+
+// Configs 插件的配置项和脱敏后的值
+func (m *Manager) Configs(id string) ([]ConfigValue, error) {
+	fields, err := m.configSchema(id)
+	if err != nil {
+		return nil, err
+	}
+	var records []AddonConfig
+	if err := m.DB.Find(&records, "addon_id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	values := make([]ConfigValue, 0, len(fields))
+	for _, field := range fields {
+		value := ConfigValue{ConfigField: field}
+		for _, record := range records {
+			if record.Key == field.Name {
+				value.Configured = true
+				value.Value = record.Value
+				if record.Secret {
+					value.Value = redacted
+				}
+			}
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// pluginConfig 插件调用时使用的配置，密钥已解密，未设置的配置项使用默认值
+func (m *Manager) pluginConfig(plugin Plugin) (map[string]string, error) {
+	id := plugin.ID()
+	m.configMutex.Lock()
+	defer m.configMutex.Unlock()
+	config, ok := m.configs[id]
+	if !ok {
+		var records []AddonConfig
+		if err := m.DB.Find(&records, "addon_id = ?", id).Error; err != nil {
+			return nil, err
+		}
+		config = make(map[string]string, len(records))
+		for _, record := range records {
+			value := record.Value
+			if record.Secret {
+				var err error
+				if value, err = m.cipher().decrypt(value); err != nil {
+					return nil, fmt.Errorf("读取配置%s出错:%s", record.Key, err.Error())
+				}
+			}
+			config[record.Key] = value
+		}
+		m.configs[id] = config
+	}
+	values := make(map[string]string, len(config))
+	for _, field := range plugin.Info().Config {
+		if value, ok := config[field.Name]; ok {
+			values[field.Name] = value
+		} else if field.Default != "" {
+			values[field.Name] = field.Default
+		} else if field.Required {
+			return nil, fmt.Errorf("插件%s缺少配置%s，请管理员私聊机器人设置", id, field.Name)
+		}
+	}
+	return values, nil
+}
+
+func (m *Manager) cipher() configCipher {
+	return configCipher{secret: m.Secret}
+}
@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+type configPlugin struct {
+	stubPlugin
+	info Info
+}
+
+func (p configPlugin) Info() Info {
+	return p.info
+}
+
+func TestPluginConfig(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&AddonConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	fields, err := ParseConfigSchema(`[{"name":"apiKey","secret":true,"required":true},{"name":"city","default":"杭州"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin := configPlugin{stubPlugin: stubPlugin{id: "weather"}, info: Info{ID: "weather", Config: fields}}
+	m := &Manager{
+		DB:      db,
+		Secret:  "test",
+		loaded:  map[string]Plugin{"weather": plugin},
+		configs: map[string]map[string]string{},
+	}
+	if _, err := m.pluginConfig(plugin); err == nil {
+		t.Fatal("缺少必填配置时应返回错误")
+	}
+	if err := m.SetConfig("weather", "unknown", "1"); err == nil {
+		t.Fatal("未定义的配置项应返回错误")
+	}
+	if err := m.SetConfig("weather", "apiKey", "sk-123"); err != nil {
+		t.Fatal(err)
+	}
+	// 密钥加密保存
+	record := new(AddonConfig)
+	db.Take(record, "addon_id = ? and `key` = ?", "weather", "apiKey")
+	if record.Value == "sk-123" || !record.Secret {
+		t.Fatalf("密钥未加密保存 %+v", record)
+	}
+	config, err := m.pluginConfig(plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config["apiKey"] != "sk-123" || config["city"] != "杭州" {
+		t.Fatalf("配置错误 %v", config)
+	}
+	values, err := m.Configs("weather")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values[0].Value != redacted || !values[0].Configured || values[1].Configured {
+		t.Fatalf("配置输出错误 %+v", values)
+	}
+	// 更换密钥后无法解密
+	m.Secret = "other"
+	m.configs = map[string]map[string]string{}
+	if _, err := m.pluginConfig(plugin); err == nil {
+		t.Fatal("密钥错误时应无法解密")
+	}
+}
@@ -0,0 +1,104 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/eatmoreapple/openwechat"
+	"gorm.io/gorm"
+	"log"
+	"sort"
+	"time"
+	"wechat-assistant/event"
+)
+
+// Subscriber 订阅事件的插件
+type Subscriber interface {
+	Plugin
+	OnEvent(db *gorm.DB, e event.Event) error
+}
+
+// validateEvents 检查插件订阅的事件类型
+func validateEvents(events []string) error {
+	for _, t := range events {
+		if !event.Valid(t) {
+			return fmt.Errorf("未知的事件类型:%s", t)
+		}
+	}
+	return nil
+}
+
+// subscribers 订阅事件的插件，群事件只包含在该群有可用绑定的插件，按插件id排序
+func (m *Manager) subscribers(e event.Event) []Subscriber {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	available := map[string]bool{}
+	if e.IsGroup() {
+		for _, key := range m.bindings(&openwechat.User{UserName: e.GID, NickName: e.GroupName}) {
+			available[m.bindMap[key]] = true
+		}
+		// 群改名时按原名称绑定的插件也需要接收
+		if e.OldName != "" {
+			for _, key := range m.bindings(&openwechat.User{UserName: e.GID, NickName: e.OldName}) {
+				available[m.bindMap[key]] = true
+			}
+		}
+	}
+	subscribers := make([]Subscriber, 0)
+	for id, plugin := range m.loaded {
+		subscriber, ok := plugin.(Subscriber)
+		if !ok || (e.IsGroup() && !available[id]) || !subscribed(plugin.Info().Events, e.Type) {
+			continue
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	sort.Slice(subscribers, func(i, j int) bool {
+		return subscribers[i].ID() < subscribers[j].ID()
+	})
+	return subscribers
+}
+
+func subscribed(events []string, eventType string) bool {
+	for _, t := range events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish 异步发送事件给订阅的插件
+func (m *Manager) Publish(e event.Event) {
+	if e.Time == 0 {
+		e.Time = time.Now().Unix()
+	}
+	subscribers := m.subscribers(e)
+	if len(subscribers) == 0 {
+		return
+	}
+	go func() {
+		for _, subscriber := range subscribers {
+			if m.isDisabled(subscriber.ID()) {
+				continue
+			}
+			if err := m.deliver(subscriber, e); err != nil {
+				log.Println("插件处理事件出错", subscriber.ID(), e.Type, err)
+			}
+		}
+	}()
+}
+
+// deliver 在插件执行超时时间内发送事件，超时的插件不会阻塞后续订阅者
+func (m *Manager) deliver(subscriber Subscriber, e event.Event) error {
+	_, err := m.execute(subscriber, e.Type, nil, func() (bool, error) {
+		return false, subscriber.OnEvent(m.DB, e)
+	})
+	return err
+}
+
+// rollover 日期切换时发送事件，通过数据库锁保证多实例时只发送一次
+func (m *Manager) rollover() {
+	now := time.Now()
+	if access, err := m.Locker.Lock("plugin-event:"+event.DayRollover+":"+now.Format(time.DateOnly), time.Hour); err != nil || access != 0 {
+		return
+	}
+	m.Publish(event.Event{Type: event.DayRollover, Time: now.Unix()})
+}
@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+	"wechat-assistant/event"
+)
+
+func TestPluginEvents(t *testing.T) {
+	plugin, err := NewCodePlugin("eventdemo", `package eventdemo
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"gorm.io/gorm"
+	"wechat-assistant/event"
+)
+
+var names []string
+
+func Events() []string {
+	return []string{event.MemberJoined}
+}
+
+func OnEvent(db *gorm.DB, e event.Event) error {
+	names = append(names, e.Names...)
+	return nil
+}
+
+func Joined() []string {
+	return names
+}
+
+func Handle(db *gorm.DB, ctx *openwechat.MessageContext) (bool, error) {
+	return false, nil
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{
+		loaded:   map[string]Plugin{"eventdemo": plugin},
+		bindMap:  map[bindKey]string{{scope: "测试群", keyword: "demo"}: "eventdemo"},
+		watchdog: newWatchdog(),
+		disabled: map[string]bool{},
+	}
+	joined := event.Event{Type: event.MemberJoined, GID: "@@group", GroupName: "测试群", Names: []string{"张三"}}
+	subscribers := m.subscribers(joined)
+	if len(subscribers) != 1 {
+		t.Fatalf("期望1个订阅插件, 实际%d", len(subscribers))
+	}
+	if err := m.deliver(subscribers[0], joined); err != nil {
+		t.Fatal(err)
+	}
+	// 插件未在其他群绑定，不接收其他群的事件
+	if subscribers := m.subscribers(event.Event{Type: event.MemberJoined, GID: "@@other", GroupName: "其他群"}); len(subscribers) != 0 {
+		t.Fatal("其他群的事件不应发送给插件")
+	}
+	// 未订阅的事件类型
+	if subscribers := m.subscribers(event.Event{Type: event.Login}); len(subscribers) != 0 {
+		t.Fatal("未订阅的事件不应发送给插件")
+	}
+	if _, err := NewCodePlugin("badevent", `package badevent
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"gorm.io/gorm"
+	"wechat-assistant/event"
+)
+
+func Events() []string {
+	return []string{"unknown"}
+}
+
+func OnEvent(db *gorm.DB, e event.Event) error {
+	return nil
+}
+
+func Handle(db *gorm.DB, ctx *openwechat.MessageContext) (bool, error) {
+	return false, nil
+}
+`); err == nil {
+		t.Fatal("未知的事件类型应返回错误")
+	}
+}
+
+type blockingSubscriber struct {
+	stubPlugin
+	release chan struct{}
+}
+
+func (s blockingSubscriber) OnEvent(*gorm.DB, event.Event) error {
+	<-s.release
+	return nil
+}
+
+func TestDeliverTimeout(t *testing.T) {
+	m := &Manager{
+		watchdog: newWatchdog(),
+		timeouts: map[string]time.Duration{"hang": 20 * time.Millisecond},
+		disabled: map[string]bool{},
+	}
+	subscriber := blockingSubscriber{stubPlugin: stubPlugin{id: "hang"}, release: make(chan struct{})}
+	defer close(subscriber.release)
+	if err := m.deliver(subscriber, event.Event{Type: event.Login}); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("期望事件处理超时, 实际%v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"gorm.io/gorm"
+	"testing"
+)
+
+type stubInterceptor struct {
+	Plugin
+	info Info
+}
+
+func (p stubInterceptor) ID() string {
+	return p.info.ID
+}
+
+func (p stubInterceptor) Info() Info {
+	return p.info
+}
+
+func (p stubInterceptor) OnMessage(*gorm.DB, *openwechat.MessageContext) (bool, error) {
+	return false, nil
+}
+
+func TestInterceptorOrder(t *testing.T) {
+	m := &Manager{
+		loaded: map[string]Plugin{
+			"audit":   stubInterceptor{info: Info{ID: "audit", Subscribe: true, Priority: -1}},
+			"counter": stubInterceptor{info: Info{ID: "counter", Subscribe: true}},
+			"archive": stubInterceptor{info: Info{ID: "archive", Subscribe: true}},
+			"silent":  stubInterceptor{info: Info{ID: "silent"}},
+			"blocked": stubInterceptor{info: Info{ID: "blocked", Subscribe: true, Priority: -2}},
+			"weather": stubPlugin{id: "weather"},
+		},
+		bindMap: map[bindKey]string{
+			{keyword: "计数"}:               "counter",
+			{keyword: "统计"}:               "counter",
+			{keyword: "归档"}:               "archive",
+			{keyword: "静默"}:               "silent",
+			{keyword: "屏蔽"}:               "blocked",
+			{keyword: "天气"}:               "weather",
+			{scope: "测试群", keyword: "审计"}: "audit",
+		},
+	}
+	group := &openwechat.User{UserName: "@@group", NickName: "测试群"}
+	var checked []string
+	bindings := m.interceptors(group, func(keyword string) bool {
+		checked = append(checked, keyword)
+		return keyword != "屏蔽"
+	})
+	var order []string
+	for _, binding := range bindings {
+		order = append(order, binding.interceptor.ID()+":"+binding.keyword)
+	}
+	// 按优先级排序，优先级相同时按插件id排序，唤醒词在群内禁用的插件不处理
+	want := []string{"audit:审计", "archive:归档", "counter:统计"}
+	if len(order) != len(want) {
+		t.Fatalf("期望%v, 实际%v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("期望%v, 实际%v", want, order)
+		}
+	}
+	for _, keyword := range checked {
+		if keyword == "天气" || keyword == "静默" {
+			t.Fatalf("未订阅消息的插件不应检查唤醒词 %v", checked)
+		}
+	}
+
+	other := &openwechat.User{UserName: "@@other", NickName: "其他群"}
+	if bindings := m.interceptors(other, func(string) bool { return true }); len(bindings) != 3 || bindings[0].interceptor.ID() != "blocked" {
+		t.Fatalf("其他群不应包含仅在测试群绑定的插件 %v", bindings)
+	}
+}
@@ -0,0 +1,197 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+	"log"
+	"sort"
+	"sync"
+	"time"
+	"wechat-assistant/job"
+)
+
+// jobParser 插件定时任务的cron表达式解析，秒可选
+var jobParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// jobLockTTL 定时任务执行锁的有效期，执行期间定时续期，执行结束后持有到下次执行前
+const jobLockTTL = 10 * time.Second
+
+type (
+	// Scheduler 声明定时任务的插件
+	Scheduler interface {
+		Plugin
+		Jobs() []job.Job
+	}
+
+	// JobInfo 已注册的插件定时任务
+	JobInfo struct {
+		PluginID string    `json:"pluginId"`
+		Name     string    `json:"name"`
+		Spec     string    `json:"spec"`
+		Next     time.Time `json:"next"`
+		LastRun  time.Time `json:"lastRun"`
+		LastErr  string    `json:"lastError"`
+	}
+
+	// jobEntry 插件定时任务的注册和执行状态
+	jobEntry struct {
+		entryId  cron.EntryID
+		schedule cron.Schedule
+		info     JobInfo
+	}
+
+	// jobRegistry 插件定时任务注册表
+	jobRegistry struct {
+		mutex   sync.Mutex
+		cron    *cron.Cron
+		entries map[string][]*jobEntry // 插件id对应的定时任务
+	}
+)
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{
+		cron:    cron.New(cron.WithParser(jobParser)),
+		entries: map[string][]*jobEntry{},
+	}
+}
+
+// validateJobs 检查定时任务声明
+func validateJobs(jobs []job.Job) error {
+	names := map[string]bool{}
+	for _, j := range jobs {
+		if j.Name == "" {
+			return errors.New("定时任务名称不能为空")
+		}
+		if names[j.Name] {
+			return fmt.Errorf("定时任务%s重复", j.Name)
+		}
+		names[j.Name] = true
+		if _, err := jobParser.Parse(j.Spec); err != nil {
+			return fmt.Errorf("定时任务%s的cron表达式错误:%s", j.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// schedule 注册插件声明的定时任务，重复注册时先注销旧任务
+func (m *Manager) schedule(plugin Plugin) {
+	m.unschedule(plugin.ID())
+	scheduler, ok := plugin.(Scheduler)
+	if !ok {
+		return
+	}
+	jobs := scheduler.Jobs()
+	if err := validateJobs(jobs); err != nil {
+		log.Println("注册插件定时任务出错", plugin.ID(), err)
+		return
+	}
+	r := m.jobs
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, j := range jobs {
+		schedule, err := jobParser.Parse(j.Spec)
+		if err != nil {
+			log.Println("注册插件定时任务出错", plugin.ID(), j.Name, err)
+			continue
+		}
+		entry := &jobEntry{schedule: schedule, info: JobInfo{PluginID: plugin.ID(), Name: j.Name, Spec: j.Spec}}
+		run := j.Run
+		entry.entryId = r.cron.Schedule(schedule, cron.FuncJob(func() { m.runJob(plugin, entry, run) }))
+		r.entries[plugin.ID()] = append(r.entries[plugin.ID()], entry)
+	}
+}
+
+// unschedule 注销插件的定时任务
+func (m *Manager) unschedule(id string) {
+	r := m.jobs
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, entry := range r.entries[id] {
+		r.cron.Remove(entry.entryId)
+	}
+	delete(r.entries, id)
+}
+
+// runJob 执行定时任务，通过数据库锁保证多实例时只执行一次，执行超时与插件调用相同
+func (m *Manager) runJob(plugin Plugin, entry *jobEntry, run func(db *gorm.DB) error) {
+	id, name := entry.info.PluginID, entry.info.Name
+	if m.isDisabled(id) {
+		return
+	}
+	key := fmt.Sprintf("plugin-job:%s:%s", id, name)
+	start := time.Now()
+	if access, err := m.Locker.Lock(key, jobLockTTL); err != nil || access != 0 {
+		return
+	}
+	done := make(chan struct{})
+	go m.keepJobLock(key, done)
+	_, err := m.execute(plugin, name, nil, func() (bool, error) {
+		return false, run(m.DB)
+	})
+	close(done)
+	// 执行锁保留到本次与下次执行的中间时刻，其他实例不会重复执行本次任务，也不会影响下次执行
+	interval := entry.schedule.Next(start).Sub(start)
+	m.Locker.Update(key, start.Add(interval/2).Sub(time.Now())-jobLockTTL)
+	if err != nil {
+		log.Println("插件定时任务执行出错", id, name, err)
+	}
+	m.jobs.mutex.Lock()
+	defer m.jobs.mutex.Unlock()
+	entry.info.LastRun = time.Now()
+	entry.info.LastErr = ""
+	if err != nil {
+		entry.info.LastErr = err.Error()
+	}
+}
+
+// keepJobLock 任务执行期间定时续期执行锁，避免执行时间较长时锁过期
+func (m *Manager) keepJobLock(key string, done <-chan struct{}) {
+	ticker := time.NewTicker(jobLockTTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			m.Locker.Update(key, jobLockTTL)
+		}
+	}
+}
+
+// Jobs 已注册的插件定时任务，按插件id和任务名称排序
+func (m *Manager) Jobs() []JobInfo {
+	r := m.jobs
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	infos := make([]JobInfo, 0, len(r.entries))
+	for _, entries := range r.entries {
+		for _, entry := range entries {
+			info := entry.info
+			info.Next = r.cron.Entry(entry.entryId).Next
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].PluginID != infos[j].PluginID {
+			return infos[i].PluginID < infos[j].PluginID
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+func (i JobInfo) String() string {
+	msg := fmt.Sprintf("%s/%s [%s]", i.PluginID, i.Name, i.Spec)
+	if !i.Next.IsZero() {
+		msg += " 下次:" + i.Next.Format(time.DateTime)
+	}
+	if !i.LastRun.IsZero() {
+		msg += " 上次:" + i.LastRun.Format(time.DateTime)
+	}
+	if i.LastErr != "" {
+		msg += " 出错:" + i.LastErr
+	}
+	return msg
+}
@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"gorm.io/gorm"
+	"sync"
+	"testing"
+	"time"
+	"wechat-assistant/job"
+)
+
+type stubLocker struct {
+	access int
+}
+
+func (l stubLocker) Lock(string, time.Duration) (int, error) {
+	return l.access, nil
+}
+
+func (l stubLocker) Update(string, time.Duration) {}
+
+// recordLocker 记录锁的续期时长
+type recordLocker struct {
+	mutex   sync.Mutex
+	updates []time.Duration
+}
+
+func (l *recordLocker) Lock(string, time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (l *recordLocker) Update(_ string, ttl time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.updates = append(l.updates, ttl)
+}
+
+func TestPluginJobs(t *testing.T) {
+	plugin, err := NewCodePlugin("jobdemo", `package jobdemo
+
+import (
+	"errors"
+	"github.com/eatmoreapple/openwechat"
+	"gorm.io/gorm"
+	"wechat-assistant/job"
+)
+
+var count int
+
+func Jobs() []job.Job {
+	return []job.Job{
+		{Name: "tick", Spec: "@every 1h", Run: func(db *gorm.DB) error { count++; return nil }},
+		{Name: "fail", Spec: "0 0 * * *", Run: func(db *gorm.DB) error { return errors.New("失败") }},
+	}
+}
+
+func Handle(db *gorm.DB, ctx *openwechat.MessageContext) (bool, error) {
+	return false, nil
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{Locker: stubLocker{}, jobs: newJobRegistry(), watchdog: newWatchdog(), disabled: map[string]bool{}}
+	m.schedule(plugin)
+	jobs := m.Jobs()
+	if len(jobs) != 2 || jobs[0].Name != "fail" || jobs[1].Name != "tick" {
+		t.Fatalf("定时任务注册错误 %v", jobs)
+	}
+	for _, entry := range m.jobs.entries["jobdemo"] {
+		for _, j := range plugin.(Scheduler).Jobs() {
+			if j.Name == entry.info.Name {
+				m.runJob(plugin, entry, j.Run)
+			}
+		}
+	}
+	jobs = m.Jobs()
+	if jobs[0].LastErr != "失败" || jobs[1].LastErr != "" || jobs[1].LastRun.IsZero() {
+		t.Fatalf("定时任务执行状态错误 %v", jobs)
+	}
+	m.unschedule("jobdemo")
+	if jobs := m.Jobs(); len(jobs) != 0 || len(m.jobs.cron.Entries()) != 0 {
+		t.Fatalf("定时任务未注销 %v", jobs)
+	}
+	if err := validateJobs([]job.Job{{Name: "bad", Spec: "* *"}}); err == nil {
+		t.Fatal("错误的cron表达式应返回错误")
+	}
+	if err := validateJobs([]job.Job{{Name: "a", Spec: "@daily"}, {Name: "a", Spec: "@daily"}}); err == nil {
+		t.Fatal("重复的任务名称应返回错误")
+	}
+}
+
+func TestJobLockRelease(t *testing.T) {
+	locker := new(recordLocker)
+	m := &Manager{Locker: locker, jobs: newJobRegistry(), watchdog: newWatchdog(), disabled: map[string]bool{}}
+	schedule, err := jobParser.Parse("@every 1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := &jobEntry{schedule: schedule, info: JobInfo{PluginID: "fast", Name: "tick"}}
+	m.runJob(stubPlugin{id: "fast"}, entry, func(db *gorm.DB) error { return nil })
+	if len(locker.updates) != 1 {
+		t.Fatalf("期望执行结束后更新锁, 实际%v", locker.updates)
+	}
+	// 执行锁需要在下次执行前失效
+	if expire := locker.updates[0] + jobLockTTL; expire <= 0 || expire >= time.Second {
+		t.Fatalf("执行锁有效期错误 %v", expire)
+	}
+
+	m.timeouts = map[string]time.Duration{"slow": 20 * time.Millisecond}
+	release := make(chan struct{})
+	defer close(release)
+	m.runJob(stubPlugin{id: "slow"}, &jobEntry{schedule: schedule, info: JobInfo{PluginID: "slow", Name: "tick"}}, func(db *gorm.DB) error {
+		<-release
+		return nil
+	})
+	if stuck := m.Stuck(); len(stuck) != 1 || stuck[0].PluginID != "slow" {
+		t.Fatalf("期望定时任务超时, 实际%v", stuck)
+	}
+}
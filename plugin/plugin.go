@@ -7,11 +7,19 @@ import (
 
 type (
 	Info struct {
-		ID          string `gorm:"primaryKey"` // 插件id
-		Package     string ``                  // 包名
-		Code        string ``                  // 加载内容
-		Keyword     string ``                  // 唤醒词
-		Description string ``                  // 描述
+		ID           string        `gorm:"primaryKey"`                // 插件id
+		Package      string        ``                                 // 包名
+		Code         string        ``                                 // 加载内容
+		Keyword      string        ``                                 // 唤醒词
+		Description  string        ``                                 // 描述
+		Usage        string        ``                                 // 用法说明
+		Examples     []string      `gorm:"serializer:json;type:text"` // 使用示例
+		Args         []Arg         `gorm:"serializer:json;type:text"` // 参数定义
+		Config       []ConfigField `gorm:"serializer:json;type:text"` // 配置定义
+		Events       []string      `gorm:"serializer:json;type:text"` // 订阅的事件
+		Subscribe    bool          ``                                 // 是否订阅群内所有消息
+		Priority     int           ``                                 // 订阅消息的处理顺序，越小越先处理
+		Capabilities []string      `gorm:"serializer:json;type:text"` // 插件声明的权限
 	}
 
 	Plugin interface {
@@ -24,4 +32,10 @@ type (
 		Destroy(db *gorm.DB) error
 		Handle(db *gorm.DB, ctx *openwechat.MessageContext) (bool, error)
 	}
+
+	// Interceptor 订阅群内所有消息的插件，OnMessage返回true时中止后续处理
+	Interceptor interface {
+		Plugin
+		OnMessage(db *gorm.DB, ctx *openwechat.MessageContext) (bool, error)
+	}
 )
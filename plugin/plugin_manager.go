@@ -10,19 +10,25 @@ import (
 	"log"
 	"net/url"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"wechat-assistant/admin"
 	"wechat-assistant/interpreter"
 	"wechat-assistant/lock"
 	"wechat-assistant/redirect"
-	"wechat-assistant/util/totp"
+	"wechat-assistant/session"
 )
 
 type (
 	Addon struct {
 		Info
-		Src string `` // 路径
+		Src      string `` // 路径
+		Version  int    `` // 当前版本号
+		Timeout  int    `` // 执行超时时间,单位秒,0表示默认值
+		Disabled bool   `` // 是否因多次超时停用
 	}
 
 	BindInfo struct {
@@ -30,24 +36,46 @@ type (
 		Keyword     string
 		Description string
 		BindKeyword string
+		Scope       string // 绑定的群名称，为空时为全局绑定
+	}
+
+	// bindKey 唤醒词绑定，scope为空时为全局绑定
+	bindKey struct {
+		scope   string
+		keyword string
+	}
+
+	hookBinding struct {
+		interceptor Interceptor
+		keyword     string
 	}
 
 	AddonBind struct {
-		ID      string `gorm:"primaryKey"` // 插件id
-		Keyword string `gorm:"primaryKey"` // 唤醒词
+		ID      string `gorm:"primaryKey"`                              // 插件id
+		Keyword string `gorm:"primaryKey"`                              // 唤醒词
+		Scope   string `gorm:"primaryKey;type:varchar(191);default:''"` // 群名称，为空时为全局绑定
 	}
 )
 
 type Manager struct {
 	container di.DI
-	Secret    string              `value:"bot.secret"`
+	Admin     *admin.Manager      `aware:""`
 	DB        *gorm.DB            `aware:"db"`
 	Locker    lock.Locker         `aware:""`
 	Resty     *resty.Client       `aware:"resty"`
 	Sender    *redirect.MsgSender `aware:""`
+	Secret    string              `value:"plugin.secret"` // 密钥配置的加密密钥
 	mutex     sync.RWMutex
-	loaded    map[string]Plugin // 已加载的插件
-	bindMap   map[string]string // 映射关系
+	loaded    map[string]Plugin  // 已加载的插件
+	bindMap   map[bindKey]string // 映射关系
+	sessions  *sessionStore      // 多轮会话
+	watchdog  *watchdog          // 超时调用记录
+	jobs      *jobRegistry       // 插件定时任务
+	timeouts  map[string]time.Duration
+	disabled  map[string]bool
+	// 插件配置缓存
+	configMutex sync.Mutex
+	configs     map[string]map[string]string
 }
 
 func (m *Manager) BeanName() string {
@@ -57,19 +85,47 @@ func (m *Manager) BeanName() string {
 func (m *Manager) BeanConstruct(container di.DI) {
 	m.container = container
 	m.loaded = map[string]Plugin{}
-	m.bindMap = map[string]string{}
+	m.bindMap = map[bindKey]string{}
+	m.sessions = newSessionStore()
+	m.watchdog = newWatchdog()
+	m.jobs = newJobRegistry()
+	m.timeouts = map[string]time.Duration{}
+	m.disabled = map[string]bool{}
+	m.configs = map[string]map[string]string{}
 }
 
 func (m *Manager) AfterPropertiesSet() {
-	if err := m.DB.AutoMigrate(&Addon{}, &AddonBind{}); err != nil {
+	if err := m.migrateBind(); err != nil {
+		log.Fatalln("升级插件绑定表出错", err)
+	}
+	if err := m.DB.AutoMigrate(&Addon{}, &AddonBind{}, &AddonVersion{}, &AddonStorage{}, &AddonConfig{}); err != nil {
 		log.Fatalln("初始化插件表出错", err)
 	}
+	if err := m.migrateCapabilities(); err != nil {
+		log.Fatalln("升级插件权限出错", err)
+	}
 	if err := m.init(); err != nil {
 		log.Fatalln("初始化插件出错", err)
 	}
+	if _, err := m.jobs.cron.AddFunc("@daily", m.rollover); err != nil {
+		log.Fatalln("注册日期切换事件出错", err)
+	}
+	m.jobs.cron.Start()
+}
+
+func (m *Manager) Destroy() {
+	m.jobs.cron.Stop()
 }
 
 func (m *Manager) init() error {
+	var settings []Addon
+	if err := m.DB.Select("id", "timeout", "disabled").Find(&settings).Error; err != nil {
+		return err
+	}
+	for _, addon := range settings {
+		m.timeouts[addon.ID] = time.Duration(addon.Timeout) * time.Second
+		m.disabled[addon.ID] = addon.Disabled
+	}
 	var records []AddonBind
 	if err := m.DB.Find(&records).Error; err != nil {
 		return err
@@ -80,27 +136,22 @@ func (m *Manager) init() error {
 	ids := make([]string, 0, len(records))
 	for _, bind := range records {
 		ids = append(ids, bind.ID)
-		m.bindMap[bind.Keyword] = bind.ID
-		log.Println(fmt.Sprintf("已启用插件 ID:%s, bindKeyword:%s", bind.ID, bind.Keyword))
+		m.bindMap[bindKey{scope: bind.Scope, keyword: bind.Keyword}] = bind.ID
+		log.Println(fmt.Sprintf("已启用插件 ID:%s, bindKeyword:%s, scope:%s", bind.ID, bind.Keyword, bind.Scope))
 	}
 	var addons []Addon
 	if err := m.DB.Find(&addons, ids).Error; err != nil {
 		return err
 	}
 	for _, addon := range addons {
-		var plugin Plugin
-		var err error
-		if strings.HasPrefix(addon.Code, "http") {
-			plugin, err = NewRemotePlugin(addon.Package, addon.Code, m.Resty, m.Sender)
-		} else {
-			plugin, err = NewCodePlugin(addon.Package, addon.Code)
-		}
+		plugin, err := m.newPlugin(addon)
 		if err != nil {
 			return err
 		} else if err := plugin.Init(m.DB); err != nil {
 			return err
 		} else {
 			m.loaded[addon.ID] = plugin
+			m.schedule(plugin)
 		}
 	}
 
@@ -117,7 +168,8 @@ func (m *Manager) listLoaded() []BindInfo {
 			ID:          id,
 			Keyword:     plugin.Info().Keyword,
 			Description: plugin.Info().Description,
-			BindKeyword: key,
+			BindKeyword: key.keyword,
+			Scope:       key.scope,
 		})
 	}
 	return loaded
@@ -129,8 +181,7 @@ func (m *Manager) HandleManage(content string, ctx *openwechat.MessageContext) (
 	if len(subCommands) < 2 {
 		return
 	}
-	if subCommands[0] != "000000" && !totp.TOTPVerify(m.Secret, 30, subCommands[0]) {
-		log.Println("验证失败", time.Now().Format(time.DateTime), subCommands[0])
+	if !m.Admin.Verify(ctx, subCommands[0]) {
 		return
 	}
 	defer func() {
@@ -151,14 +202,22 @@ func (m *Manager) HandleManage(content string, ctx *openwechat.MessageContext) (
 		if len(commands) == 1 {
 			return false, errors.New("安装插件出错:请输入插件路径")
 		}
-		params := strings.SplitN(commands[1], " ", 3)
-		pluginPath := ""
-		if len(params) == 1 {
-			pluginPath = params[0]
+		// install 插件路径 [grant 权限1,权限2]
+		params := strings.Fields(commands[1])
+		if len(params) == 0 {
+			return false, errors.New("安装插件出错:请输入插件路径")
 		}
+		pluginPath := params[0]
+		granted := parseGrant(params[1:])
 
-		plugin, err := m.Install(pluginPath)
+		plugin, err := m.Install(pluginPath, granted...)
 		if err != nil {
+			var capErr *CapabilityError
+			if errors.As(err, &capErr) {
+				_, _ = ctx.ReplyText(fmt.Sprintf("%s\n确认授权请发送: #插件 验证码 install %s grant %s",
+					err.Error(), pluginPath, strings.Join(capErr.Missing, ",")))
+				return true, nil
+			}
 			return false, errors.New("安装插件出错:" + err.Error())
 		}
 
@@ -171,20 +230,35 @@ func (m *Manager) HandleManage(content string, ctx *openwechat.MessageContext) (
 		if info.Description != "" {
 			description += "说明:" + info.Description + "\n"
 		}
+		if len(info.Capabilities) > 0 {
+			description += "权限:" + strings.Join(info.Capabilities, ",") + "\n"
+		}
 		_, _ = ctx.ReplyText(description)
 		return true, nil
 	case "update":
 		if len(commands) == 1 {
 			return false, errors.New("更新插件出错:请输入插件ID")
 		}
-		params := strings.SplitN(commands[1], " ", 3)
+		// update 插件ID [插件路径] [grant 权限1,权限2]
+		params := strings.Fields(commands[1])
+		if len(params) == 0 {
+			return false, errors.New("更新插件出错:请输入插件ID")
+		}
 		id := params[0]
 		pluginPath := ""
-		if len(params) > 1 {
+		if len(params) > 1 && params[1] != "grant" {
 			pluginPath = params[1]
+			params = params[1:]
 		}
-		err := m.Update(id, pluginPath)
+		granted := parseGrant(params[1:])
+		err := m.Update(id, pluginPath, granted...)
 		if err != nil {
+			var capErr *CapabilityError
+			if errors.As(err, &capErr) {
+				_, _ = ctx.ReplyText(fmt.Sprintf("%s\n确认授权请发送: #插件 验证码 update %s grant %s",
+					err.Error(), strings.TrimSpace(id+" "+pluginPath), strings.Join(capErr.Missing, ",")))
+				return true, nil
+			}
 			return false, errors.New("更新插件出错:" + err.Error())
 		}
 		_, _ = ctx.ReplyText(fmt.Sprintf("插件%s更新完成", id))
@@ -193,26 +267,33 @@ func (m *Manager) HandleManage(content string, ctx *openwechat.MessageContext) (
 		if len(commands) == 1 {
 			return false, errors.New("绑定插件出错:请输入插件ID和唤醒词")
 		}
-		params := strings.SplitN(commands[1], " ", 3)
-		id := ""
+		// bind 插件ID [唤醒词] [force] [group]，group表示仅绑定到当前群
+		params := strings.Fields(commands[1])
+		if len(params) == 0 {
+			return false, errors.New("绑定插件出错:请输入插件ID和唤醒词")
+		}
+		id := params[0]
 		keyword := ""
-		force := false
-		switch len(params) {
-		case 1:
-			id = params[0]
-		case 2:
-			id = params[0]
-			keyword = params[1]
-		default:
-			id = params[0]
-			keyword = params[1]
-			force = "force" == params[2]
+		force, scope := false, ""
+		for _, param := range params[1:] {
+			switch param {
+			case "force":
+				force = true
+			case "group":
+				if scope, err = contextScope(ctx); err != nil {
+					return false, err
+				}
+			default:
+				if keyword == "" {
+					keyword = param
+				}
+			}
 		}
 		plugin, err := m.Load(id)
 		if err != nil {
 			return false, err
 		}
-		err = m.Bind(keyword, plugin, force)
+		err = m.BindGroup(scope, keyword, plugin, force)
 
 		info := plugin.Info()
 		description := "插件绑定成功，信息如下:\n"
@@ -221,14 +302,27 @@ func (m *Manager) HandleManage(content string, ctx *openwechat.MessageContext) (
 		if info.Description != "" {
 			description += "说明:" + info.Description + "\n"
 		}
+		if scope != "" {
+			description += "范围:仅" + scope + "\n"
+		}
 		_, _ = ctx.ReplyText(description)
 		return true, err
 	case "unbind":
 		if len(commands) == 1 {
 			return false, errors.New("解绑插件出错:请输入唤醒词")
 		}
-		keyword := strings.SplitN(commands[1], " ", 2)[0]
-		ok, err := m.Unbind(keyword)
+		// unbind 唤醒词 [group]，group表示解绑当前群的绑定
+		params := strings.Fields(commands[1])
+		if len(params) == 0 {
+			return false, errors.New("解绑插件出错:请输入唤醒词")
+		}
+		keyword, scope := params[0], ""
+		if len(params) > 1 && params[1] == "group" {
+			if scope, err = contextScope(ctx); err != nil {
+				return false, err
+			}
+		}
+		ok, err := m.UnbindGroup(scope, keyword)
 		if !ok {
 			return true, errors.New(fmt.Sprintf("解绑插件出错:唤醒词[%s]未绑定插件", keyword))
 		}
@@ -248,6 +342,143 @@ func (m *Manager) HandleManage(content string, ctx *openwechat.MessageContext) (
 		}
 		_, _ = ctx.ReplyText(fmt.Sprintf("插件%s重载完成", id))
 		return true, nil
+	case "versions":
+		if len(commands) == 1 {
+			return false, errors.New("请输入插件ID")
+		}
+		id := strings.SplitN(commands[1], " ", 2)[0]
+		versions, err := m.Versions(id)
+		if err != nil {
+			return false, errors.New("查询插件版本出错")
+		}
+		if len(versions) == 0 {
+			_, _ = ctx.ReplyText("未找到插件版本记录")
+			return true, nil
+		}
+		current := new(Addon)
+		m.DB.Select("version").Take(current, "id = ?", id)
+		msg := fmt.Sprintf("插件%s的版本如下:\n", id)
+		for _, v := range versions {
+			msg += v.String()
+			if v.Version == current.Version {
+				msg += "(当前)"
+			}
+			msg += "\n"
+		}
+		_, _ = ctx.ReplyText(msg)
+		return true, nil
+	case "rollback":
+		if len(commands) == 1 {
+			return false, errors.New("恢复插件版本出错:请输入插件ID")
+		}
+		params := strings.Fields(commands[1])
+		id := params[0]
+		version := 0
+		if len(params) > 1 {
+			if version, err = strconv.Atoi(strings.TrimPrefix(params[1], "v")); err != nil {
+				return false, errors.New("恢复插件版本出错:版本号错误")
+			}
+		}
+		target, err := m.Rollback(id, version)
+		if err != nil {
+			return false, errors.New("恢复插件版本出错:" + err.Error())
+		}
+		_, _ = ctx.ReplyText(fmt.Sprintf("插件%s已恢复到版本v%d", id, target.Version))
+		return true, nil
+	case "config":
+		// config 插件ID [配置项 值]，值为clear时恢复默认值
+		if len(commands) == 1 {
+			return false, errors.New("请输入插件ID")
+		}
+		params := strings.SplitN(strings.TrimSpace(commands[1]), " ", 3)
+		id := params[0]
+		if len(params) == 1 {
+			values, err := m.Configs(id)
+			if err != nil {
+				return false, errors.New("查询插件配置出错:" + err.Error())
+			}
+			if len(values) == 0 {
+				_, _ = ctx.ReplyText(fmt.Sprintf("插件%s没有配置项", id))
+				return true, nil
+			}
+			msg := fmt.Sprintf("插件%s的配置如下:\n", id)
+			for _, v := range values {
+				msg += v.String() + "\n"
+			}
+			_, _ = ctx.ReplyText(msg)
+			return true, nil
+		}
+		if len(params) < 3 {
+			return false, errors.New("设置插件配置出错:请输入配置值")
+		}
+		key, value := params[1], strings.TrimSpace(params[2])
+		if value == "clear" {
+			value = ""
+		}
+		fields, err := m.configSchema(id)
+		if err != nil {
+			return false, errors.New("设置插件配置出错:" + err.Error())
+		}
+		if field, ok := findConfigField(fields, key); ok && field.Secret && value != "" && !ctx.IsSendByFriend() {
+			return false, errors.New("密钥配置请私聊机器人设置")
+		}
+		if err := m.SetConfig(id, key, value); err != nil {
+			return false, errors.New("设置插件配置出错:" + err.Error())
+		}
+		_, _ = ctx.ReplyText(fmt.Sprintf("插件%s配置%s已更新", id, key))
+		return true, nil
+	case "timeout":
+		// timeout 插件ID 秒数，0表示使用默认值
+		if len(commands) == 1 {
+			return false, errors.New("设置超时出错:请输入插件ID")
+		}
+		params := strings.Fields(commands[1])
+		if len(params) < 2 {
+			return false, errors.New("设置超时出错:请输入超时秒数")
+		}
+		seconds, err := strconv.Atoi(params[1])
+		if err != nil || seconds < 0 {
+			return false, errors.New("设置超时出错:超时秒数错误")
+		}
+		if err := m.SetTimeout(params[0], time.Duration(seconds)*time.Second); err != nil {
+			return false, errors.New("设置超时出错:" + err.Error())
+		}
+		_, _ = ctx.ReplyText(fmt.Sprintf("插件%s执行超时时间为%s", params[0], m.timeoutOf(params[0])))
+		return true, nil
+	case "enable":
+		if len(commands) == 1 {
+			return false, errors.New("请输入插件ID")
+		}
+		id := strings.SplitN(commands[1], " ", 2)[0]
+		if err := m.Enable(id); err != nil {
+			return false, errors.New("启用插件出错:" + err.Error())
+		}
+		_, _ = ctx.ReplyText(fmt.Sprintf("插件%s已启用", id))
+		return true, nil
+	case "jobs":
+		jobs := m.Jobs()
+		if len(jobs) == 0 {
+			_, _ = ctx.ReplyText("当前没有插件定时任务")
+			return true, nil
+		}
+		msg := "插件定时任务如下:\n"
+		for _, v := range jobs {
+			msg += v.String() + "\n"
+		}
+		_, _ = ctx.ReplyText(msg)
+		return true, nil
+	case "stuck":
+		invocations := m.Stuck()
+		if len(invocations) == 0 {
+			_, _ = ctx.ReplyText("当前没有超时未结束的插件调用")
+			return true, nil
+		}
+		msg := "超时未结束的插件调用如下:\n"
+		for _, v := range invocations {
+			msg += fmt.Sprintf("%s [%s] 已运行%s\n", v.PluginID, v.Keyword, time.Since(v.Start).Truncate(time.Second))
+		}
+		_, _ = ctx.ReplyText(msg)
+		return true, nil
 	case "uninstall":
 		if len(commands) == 1 {
 			return false, errors.New("请输入插件ID")
@@ -284,6 +515,11 @@ func (m *Manager) HandleManage(content string, ctx *openwechat.MessageContext) (
 					if v.Description != "" {
 						msg += fmt.Sprintf("--说明:%s\n", v.Description)
 					}
+				} else if v.Scope != "" {
+					msg += fmt.Sprintf("ID:%s, 唤醒词:[%s], 仅%s\n", v.ID, v.BindKeyword, v.Scope)
+					if v.Description != "" {
+						msg += fmt.Sprintf("--说明:%s\n", v.Description)
+					}
 				} else {
 					msg += fmt.Sprintf("ID:%s, 唤醒词:[%s]\n", v.ID, v.Keyword)
 					if v.Description != "" {
@@ -315,12 +551,15 @@ func (m *Manager) recycle() {
 	// 回收销毁插件
 	for _, id := range unbindId {
 		plugin := m.loaded[id]
+		m.unschedule(id)
 		_ = plugin.Destroy(m.DB)
 		delete(m.loaded, id)
+		m.sessions.releasePlugin(id)
 	}
 }
 
-func (m *Manager) Install(pluginPath string) (plugin Plugin, err error) {
+// Install 安装插件，granted为管理员授权的权限
+func (m *Manager) Install(pluginPath string, granted ...string) (plugin Plugin, err error) {
 	var packageName, code string
 	if strings.HasPrefix(pluginPath, "[remote]http") {
 		api, err := url.ParseRequestURI(strings.TrimPrefix(pluginPath, "[remote]"))
@@ -336,7 +575,7 @@ func (m *Manager) Install(pluginPath string) (plugin Plugin, err error) {
 		if err != nil {
 			return nil, err
 		}
-		plugin, err = NewCodePlugin(packageName, code)
+		plugin, err = NewCodePlugin(packageName, code, granted...)
 	}
 	if err != nil {
 		return nil, err
@@ -350,16 +589,24 @@ func (m *Manager) Install(pluginPath string) (plugin Plugin, err error) {
 	} else if record != nil {
 		return nil, errors.New("存在同名插件")
 	}
-	if err := m.DB.Create(Addon{
+	addon := Addon{
 		Info: plugin.Info(),
 		Src:  pluginPath,
-	}).Error; err != nil {
+	}
+	if err := m.DB.Transaction(func(tx *gorm.DB) (err error) {
+		if addon.Version, err = saveVersion(tx, addon); err != nil {
+			return err
+		}
+		return tx.Create(addon).Error
+	}); err != nil {
 		return nil, errors.New("插件安装失败")
 	}
 	return plugin, nil
 }
 
-func (m *Manager) Update(id string, src string) error {
+// Update 更新插件代码，新代码编译通过后替换已加载的实例，新实例初始化失败时保留旧实例
+// granted为本次新授权的权限，插件已授权的权限无需重复授权
+func (m *Manager) Update(id string, src string, granted ...string) error {
 	addon := new(Addon)
 	if err := m.DB.First(addon, "id = ?", id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -368,16 +615,93 @@ func (m *Manager) Update(id string, src string) error {
 			return errors.New("获取插件信息出错")
 		}
 	}
+	// 升级前安装的插件没有版本记录，先保存当前代码
+	if addon.Version == 0 {
+		if _, err := saveVersion(m.DB, *addon); err != nil {
+			return errors.New("保存插件版本出错")
+		}
+	}
 	if src != "" {
 		addon.Src = src
 	}
-	packageName, code, err := interpreter.GetCode(addon.Src)
+	if !strings.HasPrefix(addon.Src, "[remote]") {
+		packageName, code, err := interpreter.GetCode(addon.Src)
+		if err != nil {
+			return err
+		}
+		addon.Package = packageName
+		addon.Code = code
+	}
+	// 先编译新代码，编译失败时不做任何修改
+	plugin, err := m.newPlugin(*addon, granted...)
 	if err != nil {
-		return err
+		var capErr *CapabilityError
+		if errors.As(err, &capErr) {
+			return err
+		}
+		return errors.New("编译插件出错:" + err.Error())
+	}
+	if plugin.ID() != id {
+		return fmt.Errorf("插件包名%s与插件ID不一致", plugin.ID())
+	}
+	addon.Info = plugin.Info()
+	return m.replace(id, plugin, func() (err error) {
+		return m.DB.Transaction(func(tx *gorm.DB) error {
+			if addon.Version, err = saveVersion(tx, *addon); err != nil {
+				return err
+			}
+			return tx.Save(addon).Error
+		})
+	})
+}
+
+// replace 替换已加载的插件实例并执行保存，新实例初始化或保存失败时恢复旧实例
+func (m *Manager) replace(id string, plugin Plugin, save func() error) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	old, loaded := m.loaded[id]
+	if loaded {
+		plugin.Keyword(old.Keyword())
+		m.unschedule(id)
+		if err := old.Destroy(m.DB); err != nil {
+			log.Println("销毁旧插件出错", id, err)
+		}
+		if err := plugin.Init(m.DB); err != nil {
+			m.restore(id, old)
+			return errors.New("初始化插件出错:" + err.Error())
+		}
+	}
+	if err := save(); err != nil {
+		if loaded {
+			_ = plugin.Destroy(m.DB)
+			m.restore(id, old)
+		}
+		return errors.New("保存插件出错:" + err.Error())
+	}
+	if loaded {
+		m.loaded[id] = plugin
+		m.schedule(plugin)
+		m.sessions.releasePlugin(id)
+	}
+	return nil
+}
+
+// restore 重新初始化旧插件实例
+func (m *Manager) restore(id string, old Plugin) {
+	if err := old.Init(m.DB); err != nil {
+		log.Println("恢复旧插件出错", id, err)
+		return
+	}
+	m.schedule(old)
+}
+
+// newPlugin 创建插件实例，插件已授权的权限与granted合并
+func (m *Manager) newPlugin(addon Addon, granted ...string) (Plugin, error) {
+	if strings.HasPrefix(addon.Code, "http") {
+		return NewRemotePlugin(addon.Package, addon.Code, m.Resty, m.Sender)
+	} else {
+		return NewCodePlugin(addon.Package, addon.Code, append(granted, addon.Capabilities...)...)
 	}
-	addon.Package = packageName
-	addon.Code = code
-	return m.DB.Save(addon).Error
 }
 
 func (m *Manager) Load(id string) (Plugin, error) {
@@ -389,11 +713,7 @@ func (m *Manager) Load(id string) (Plugin, error) {
 			return nil, errors.New("加载插件出错")
 		}
 	}
-	if strings.HasPrefix(addon.Code, "http") {
-		return NewRemotePlugin(addon.Package, addon.Code, m.Resty, m.Sender)
-	} else {
-		return NewCodePlugin(addon.Package, addon.Code)
-	}
+	return m.newPlugin(*addon)
 }
 
 func (m *Manager) List(fromDB bool) (*[]BindInfo, error) {
@@ -417,7 +737,8 @@ func (m *Manager) List(fromDB bool) (*[]BindInfo, error) {
 						ID:          addon.ID,
 						Keyword:     addon.Keyword,
 						Description: addon.Description,
-						BindKeyword: k,
+						BindKeyword: k.keyword,
+						Scope:       k.scope,
 					})
 				}
 			}
@@ -435,7 +756,13 @@ func (m *Manager) List(fromDB bool) (*[]BindInfo, error) {
 	return &bindInfos, nil
 }
 
+// Bind 全局绑定插件唤醒词
 func (m *Manager) Bind(keyword string, plugin Plugin, force bool) error {
+	return m.BindGroup("", keyword, plugin, force)
+}
+
+// BindGroup 绑定插件唤醒词到指定群，scope为空时为全局绑定。群绑定优先于全局绑定
+func (m *Manager) BindGroup(scope string, keyword string, plugin Plugin, force bool) error {
 	keyword = plugin.Keyword(keyword)
 	if keyword == "" {
 		return errors.New("插件未绑定唤醒词")
@@ -449,7 +776,8 @@ func (m *Manager) Bind(keyword string, plugin Plugin, force bool) error {
 		plugin = old
 	}
 	// 检查唤醒词绑定状态
-	bindId, bound := m.bindMap[keyword]
+	key := bindKey{scope: scope, keyword: keyword}
+	bindId, bound := m.bindMap[key]
 	// 唤醒词已绑定且不为强制绑定时，返回错误
 	if bound && !force {
 		return errors.New(fmt.Sprintf("唤醒词[%s]已被占用,请先卸载或更换唤醒词绑定", keyword))
@@ -458,7 +786,7 @@ func (m *Manager) Bind(keyword string, plugin Plugin, force bool) error {
 	if err := m.DB.Transaction(func(tx *gorm.DB) error {
 		// 如果已绑定，先清除原有绑定关系
 		if bound {
-			err := m.DB.Where("id = ? and keyword = ?", bindId, keyword).Delete(&AddonBind{}).Error
+			err := m.DB.Where("id = ? and keyword = ? and scope = ?", bindId, keyword, scope).Delete(&AddonBind{}).Error
 			if err != nil {
 				return errors.New("更新插件信息出错")
 			}
@@ -467,6 +795,7 @@ func (m *Manager) Bind(keyword string, plugin Plugin, force bool) error {
 		if err := m.DB.Create(AddonBind{
 			ID:      plugin.ID(),
 			Keyword: keyword,
+			Scope:   scope,
 		}).Error; err != nil {
 			return errors.New("绑定插件出错")
 		}
@@ -478,8 +807,11 @@ func (m *Manager) Bind(keyword string, plugin Plugin, force bool) error {
 				return errors.New("初始化插件出错")
 			}
 		}
+		if !loaded {
+			m.schedule(plugin)
+		}
 		m.loaded[plugin.ID()] = plugin
-		m.bindMap[keyword] = plugin.ID()
+		m.bindMap[key] = plugin.ID()
 
 		return nil
 	}); err != nil {
@@ -493,35 +825,42 @@ func (m *Manager) Bind(keyword string, plugin Plugin, force bool) error {
 }
 
 func (m *Manager) Reload(id string) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
+	m.mutex.RLock()
 	_, loaded := m.loaded[id]
+	m.mutex.RUnlock()
 	if !loaded {
 		return errors.New(fmt.Sprintf("插件%s未加载", id))
 	}
 	plugin, err := m.Load(id)
 	if err != nil {
 		return err
+	} else if plugin == nil {
+		return errors.New(fmt.Sprintf("插件%s不存在", id))
 	}
-	m.loaded[id] = plugin
-	return nil
+	return m.replace(id, plugin, func() error { return nil })
 }
 
+// Unbind 解绑全局唤醒词
 func (m *Manager) Unbind(keyword string) (bool, error) {
+	return m.UnbindGroup("", keyword)
+}
+
+// UnbindGroup 解绑指定群的唤醒词，scope为空时解绑全局唤醒词
+func (m *Manager) UnbindGroup(scope string, keyword string) (bool, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	bindId, ok := m.bindMap[keyword]
+	key := bindKey{scope: scope, keyword: keyword}
+	bindId, ok := m.bindMap[key]
 	if ok {
 		err := m.DB.Transaction(func(tx *gorm.DB) error {
-			err := m.DB.Where("id = ? and keyword = ?", bindId, keyword).
+			err := m.DB.Where("id = ? and keyword = ? and scope = ?", bindId, keyword, scope).
 				Delete(&AddonBind{}).
 				Error
 			if err != nil {
 				return errors.New("解绑插件信息出错")
 			}
-			delete(m.bindMap, keyword)
+			delete(m.bindMap, key)
 			m.recycle()
 			return err
 		})
@@ -554,18 +893,32 @@ func (m *Manager) Uninstall(id string) (ok bool, err error) {
 		if err := m.DB.Where("id = ?", addon.ID).Delete(&AddonBind{}).Error; err != nil {
 			return errors.New("卸载插件出错")
 		}
+		if err := m.DB.Where("addon_id = ?", addon.ID).Delete(&AddonVersion{}).Error; err != nil {
+			return errors.New("卸载插件出错")
+		}
+		if err := m.DB.Where("addon_id = ?", addon.ID).Delete(&AddonStorage{}).Error; err != nil {
+			return errors.New("卸载插件出错")
+		}
+		if err := m.DB.Where("addon_id = ?", addon.ID).Delete(&AddonConfig{}).Error; err != nil {
+			return errors.New("卸载插件出错")
+		}
 
 		// 扫描插件id已绑定的关键词
-		boundKeyword := make([]string, 0, len(m.bindMap))
-		for keyword, id := range m.bindMap {
+		boundKeyword := make([]bindKey, 0, len(m.bindMap))
+		for key, id := range m.bindMap {
 			if id == addon.ID {
-				boundKeyword = append(boundKeyword, keyword)
+				boundKeyword = append(boundKeyword, key)
 			}
 		}
 		// 清除绑定
-		for _, keyword := range boundKeyword {
-			delete(m.bindMap, keyword)
+		for _, key := range boundKeyword {
+			delete(m.bindMap, key)
 		}
+		delete(m.disabled, addon.ID)
+		delete(m.timeouts, addon.ID)
+		m.configMutex.Lock()
+		delete(m.configs, addon.ID)
+		m.configMutex.Unlock()
 		// 回收
 		m.recycle()
 
@@ -575,15 +928,39 @@ func (m *Manager) Uninstall(id string) (ok bool, err error) {
 	return
 }
 
-func (m *Manager) FindByKeyword(keyword string) Plugin {
+// FindByKeyword 查找唤醒词在群内绑定的插件，群内没有绑定时使用全局绑定，ctx为空时只查找全局绑定
+func (m *Manager) FindByKeyword(keyword string, ctx *openwechat.MessageContext) Plugin {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	id, ok := m.bindMap[keyword]
+	key, ok := m.resolve(contextGroup(ctx), keyword)
 	if !ok {
 		return nil
 	}
-	return m.loaded[id]
+	return m.loaded[m.bindMap[key]]
+}
+
+// Available 群内可用的插件绑定，群绑定覆盖同名的全局绑定
+func (m *Manager) Available(ctx *openwechat.MessageContext) []BindInfo {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	bindings := m.bindings(contextGroup(ctx))
+	available := make([]BindInfo, 0, len(bindings))
+	for keyword, key := range bindings {
+		id := m.bindMap[key]
+		info := m.loaded[id].Info()
+		available = append(available, BindInfo{
+			ID:          id,
+			Keyword:     info.Keyword,
+			Description: info.Description,
+			BindKeyword: keyword,
+			Scope:       key.scope,
+		})
+	}
+	sort.Slice(available, func(i, j int) bool {
+		return available[i].BindKeyword < available[j].BindKeyword
+	})
+	return available
 }
 
 func (m *Manager) Invoke(keyword string, params []string, db *gorm.DB, ctx *openwechat.MessageContext) (ok bool, err error) {
@@ -600,13 +977,174 @@ func (m *Manager) Invoke(keyword string, params []string, db *gorm.DB, ctx *open
 		}
 	}()
 
-	plugin := m.FindByKeyword(keyword)
+	plugin := m.FindByKeyword(keyword, ctx)
 	if plugin == nil {
 		return false, nil
 	}
+	if err := ValidateArgs(plugin.Info().Args, params); err != nil {
+		return false, errors.New(err.Error() + "\n" + plugin.Info().Help(keyword))
+	}
+	if err := m.prepare(plugin, keyword, params, ctx, false); err != nil {
+		return false, err
+	}
+	return m.execute(plugin, keyword, ctx, func() (bool, error) {
+		return plugin.Handle(db, ctx)
+	})
+}
+
+// InvokeSession 将消息交给占用会话的插件处理，存在会话时返回true
+func (m *Manager) InvokeSession(db *gorm.DB, ctx *openwechat.MessageContext) (ok bool, err error) {
+	key, err := contextSessionKey(ctx)
+	if err != nil {
+		return false, nil
+	}
+	state := m.sessions.get(key)
+	if state == nil {
+		return false, nil
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			switch e.(type) {
+			case error:
+				err = e.(error)
+			case string:
+				err = errors.New(e.(string))
+			default:
+				err = errors.New("插件调用出错:" + state.keyword)
+			}
+		}
+	}()
+
+	m.mutex.RLock()
+	plugin, loaded := m.loaded[state.pluginId]
+	m.mutex.RUnlock()
+	if !loaded {
+		m.sessions.releasePlugin(state.pluginId)
+		return false, nil
+	}
+	m.sessions.touch(key)
+	if err := m.prepare(plugin, state.keyword, []string{strings.TrimSpace(ctx.Content)}, ctx, true); err != nil {
+		return true, err
+	}
+	// 会话中的消息不再进行指令解析
+	_, err = m.execute(plugin, state.keyword, ctx, func() (bool, error) {
+		return plugin.Handle(db, ctx)
+	})
+	return true, err
+}
+
+// interceptors 获取订阅消息的插件，按处理顺序排序，enabled用于检查插件唤醒词在当前群是否启用
+func (m *Manager) interceptors(group *openwechat.User, enabled func(keyword string) bool) []hookBinding {
+	// 持有锁时只复制绑定关系，enabled可能查询数据库
+	m.mutex.RLock()
+	var candidates []hookBinding
+	for keyword, key := range m.bindings(group) {
+		interceptor, ok := m.loaded[m.bindMap[key]].(Interceptor)
+		if ok && interceptor.Info().Subscribe {
+			candidates = append(candidates, hookBinding{interceptor: interceptor, keyword: keyword})
+		}
+	}
+	m.mutex.RUnlock()
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].keyword < candidates[j].keyword
+	})
+	bindings := map[string]hookBinding{}
+	for _, candidate := range candidates {
+		id := candidate.interceptor.ID()
+		if _, exist := bindings[id]; exist || !enabled(candidate.keyword) {
+			continue
+		}
+		bindings[id] = candidate
+	}
+	sorted := make([]hookBinding, 0, len(bindings))
+	for _, binding := range bindings {
+		sorted = append(sorted, binding)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i].interceptor.Info(), sorted[j].interceptor.Info()
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.ID < b.ID
+	})
+	return sorted
+}
+
+// InvokeHooks 将消息依次交给订阅消息的插件，插件要求中止时返回true
+func (m *Manager) InvokeHooks(db *gorm.DB, ctx *openwechat.MessageContext, enabled func(keyword string) bool) bool {
+	for _, binding := range m.interceptors(contextGroup(ctx), enabled) {
+		if err := m.prepare(binding.interceptor, binding.keyword, []string{strings.TrimSpace(ctx.Content)}, ctx, false); errors.Is(err, ErrTimeout) {
+			// 已有插件超时，不再交给后续插件处理
+			return false
+		} else if err != nil {
+			log.Println("插件订阅消息处理出错", binding.interceptor.ID(), err)
+			continue
+		}
+		interceptor := binding.interceptor
+		stop, err := m.execute(interceptor, binding.keyword, ctx, func() (bool, error) {
+			return interceptor.OnMessage(db, ctx)
+		})
+		if err != nil {
+			log.Println("插件订阅消息处理出错", binding.interceptor.ID(), err)
+		}
+		if stop {
+			return true
+		}
+	}
+	return false
+}
+
+// prepare 设置插件调用的上下文，插件缺少必填配置时返回错误
+func (m *Manager) prepare(plugin Plugin, keyword string, params []string, ctx *openwechat.MessageContext, active bool) error {
+	if timedOut(ctx) {
+		return ErrTimeout
+	}
+	config, err := m.pluginConfig(plugin)
+	if err != nil {
+		return err
+	}
+	ctx.Set("config", config)
 	ctx.Set("pluginParams", params)
-	ctx.Set("di", m.container)
-	ctx.Set("locker", m.Locker)
-	ctx.Set("resty", m.Resty)
-	return plugin.Handle(db, ctx)
+	// 依赖注入容器和http客户端只提供给已授权的插件
+	if interpreter.HasCapability(plugin.Info().Capabilities, interpreter.CapDI) {
+		ctx.Set("di", m.container)
+	} else {
+		ctx.Set("di", nil)
+	}
+	if interpreter.HasCapability(plugin.Info().Capabilities, interpreter.CapNetwork) {
+		ctx.Set("resty", m.Resty)
+	} else {
+		ctx.Set("resty", nil)
+	}
+	ctx.Set("locker", lock.Locker(pluginLocker{locker: m.Locker}))
+	var groupName, userName string
+	if group, err := ctx.Sender(); err == nil && group.IsGroup() {
+		groupName = group.NickName
+		if user, err := ctx.SenderInGroup(); err == nil {
+			userName = user.NickName
+		}
+	}
+	ctx.Set("storage", newStorage(m.DB, plugin.ID(), groupName, userName))
+	if key, err := contextSessionKey(ctx); err == nil {
+		ctx.Set("session", session.Session(&sessionHandle{
+			store:    m.sessions,
+			key:      key,
+			pluginId: plugin.ID(),
+			keyword:  keyword,
+			active:   active,
+		}))
+	}
+	return nil
+}
+
+func contextSessionKey(ctx *openwechat.MessageContext) (string, error) {
+	group, err := ctx.Sender()
+	if err != nil {
+		return "", err
+	}
+	user, err := ctx.SenderInGroup()
+	if err != nil {
+		return "", err
+	}
+	return sessionKey(group.UserName, user.UserName), nil
 }
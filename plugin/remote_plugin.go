@@ -1,6 +1,7 @@
 package plugin
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/json"
 	"errors"
@@ -10,12 +11,17 @@ import (
 	"gorm.io/gorm"
 	"log"
 	"strings"
+	"time"
+	"wechat-assistant/event"
+	"wechat-assistant/job"
 	"wechat-assistant/redirect"
+	"wechat-assistant/session"
 )
 
 // RemotePlugin 远程插件
 type RemotePlugin struct {
 	info   Info
+	jobs   []remoteJob
 	client *resty.Client
 	sender *redirect.MsgSender
 }
@@ -31,6 +37,14 @@ func (p *RemotePlugin) loadInfo() {
 	}
 	p.info.Keyword = info.Keyword
 	p.info.Description = info.Description
+	p.info.Usage = info.Usage
+	p.info.Examples = info.Examples
+	p.info.Args = info.Args
+	p.info.Config = info.Config
+	p.info.Subscribe = info.Subscribe
+	p.info.Priority = info.Priority
+	p.jobs = info.Jobs
+	p.info.Events = info.Events
 }
 
 func (p *RemotePlugin) Info() Info {
@@ -69,6 +83,44 @@ func (p *RemotePlugin) Destroy(db *gorm.DB) error {
 	return nil
 }
 
+// Jobs 远程插件声明的定时任务，执行时回调插件接口
+func (p *RemotePlugin) Jobs() []job.Job {
+	jobs := make([]job.Job, 0, len(p.jobs))
+	for _, j := range p.jobs {
+		name := j.Name
+		jobs = append(jobs, job.Job{Name: name, Spec: j.Spec, Run: func(*gorm.DB) error {
+			return p.runJob(name)
+		}})
+	}
+	return jobs
+}
+
+// OnEvent 将订阅的事件发送给远程插件
+func (p *RemotePlugin) OnEvent(_ *gorm.DB, e event.Event) error {
+	return p.post(remoteEventRequest{Event: e})
+}
+
+// runJob 回调远程插件执行定时任务
+func (p *RemotePlugin) runJob(name string) error {
+	return p.post(remoteJobRequest{Job: name, Time: time.Now().Unix()})
+}
+
+// post 回调远程插件接口，响应包含错误信息时返回错误
+func (p *RemotePlugin) post(body interface{}) error {
+	resp, err := p.client.R().SetBody(body).Post(p.info.Code)
+	if err != nil {
+		return err
+	}
+	if !resp.IsSuccess() {
+		return errors.New(resp.Status())
+	}
+	response := new(remotePluginResponse)
+	if err := json.Unmarshal(resp.Body(), response); err == nil && response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
 func NewRemotePlugin(packageName string, api string, client *resty.Client, sender *redirect.MsgSender) (Plugin, error) {
 	plugin := &RemotePlugin{
 		info: Info{
@@ -84,26 +136,53 @@ func NewRemotePlugin(packageName string, api string, client *resty.Client, sende
 }
 
 func (p *RemotePlugin) Handle(_ *gorm.DB, ctx *openwechat.MessageContext) (bool, error) {
+	ok, _, err := p.invoke(ctx, false)
+	return ok, err
+}
+
+// OnMessage 订阅消息的远程插件接收群内所有消息，响应stop为true时中止后续处理
+func (p *RemotePlugin) OnMessage(_ *gorm.DB, ctx *openwechat.MessageContext) (bool, error) {
+	if !p.info.Subscribe {
+		return false, nil
+	}
+	_, stop, err := p.invoke(ctx, true)
+	return stop, err
+}
+
+// invoke 调用远程插件，返回是否已处理和是否中止后续处理
+func (p *RemotePlugin) invoke(ctx *openwechat.MessageContext, hook bool) (ok bool, stop bool, err error) {
 	v, ok := ctx.Get("pluginParams")
 	if !ok {
-		return false, nil
+		return false, stop, nil
 	}
 	params, ok := v.([]string)
 	if !ok {
-		return false, nil
+		return false, stop, nil
 	}
 
+	var handle session.Session
+	if v, ok := ctx.Get("session"); ok {
+		handle, _ = v.(session.Session)
+	}
 	msg := remotePluginRequest{
+		Session:    handle != nil && handle.Active(),
+		Hook:       hook,
 		MsgID:      ctx.MsgId,
 		Time:       ctx.CreateTime,
 		MsgType:    int(ctx.MsgType),
 		Message:    strings.Join(params, " "),
 		RawMessage: ctx.Content,
 	}
+	if v, ok := ctx.Get("mentions"); ok {
+		msg.Mentions, _ = v.([]string)
+	}
+	if v, ok := ctx.Get("config"); ok {
+		msg.Config, _ = v.(map[string]string)
+	}
 	// 发送者信息
 	sender, err := ctx.Sender()
 	if err != nil {
-		return false, nil
+		return false, stop, nil
 	}
 	group, _ := sender.AsGroup()
 	msg.GID = group.UserName
@@ -124,61 +203,97 @@ func (p *RemotePlugin) Handle(_ *gorm.DB, ctx *openwechat.MessageContext) (bool,
 		msg.Username = user.NickName
 	}
 
-	resp, err := p.client.R().SetBody(msg).Post(p.info.Code)
+	req := p.client.R().SetBody(msg)
+	if value, exist := ctx.Get("context"); exist {
+		// 超时后取消请求
+		req.SetContext(value.(context.Context))
+	}
+	resp, err := req.Post(p.info.Code)
 	if err != nil {
 		log.Println("远程插件调用失败", err)
-		return false, err
+		return false, stop, err
 	}
 	if !resp.IsSuccess() {
 		err := errors.New(resp.Status())
 		log.Println("远程插件调用失败", err)
-		return false, err
+		return false, stop, err
 	}
 	response := new(remotePluginResponse)
 	err = json.Unmarshal(resp.Body(), response)
 	if err != nil {
-		return false, err
+		return false, stop, err
 	}
+	stop = hook && response.Stop
 	msgType, _ := response.Type.Int64()
+	if handle != nil {
+		if response.Session > 0 {
+			handle.Claim(time.Duration(response.Session) * time.Second)
+		} else if response.Session < 0 {
+			handle.Release()
+		}
+	}
 
 	if response.Error != "" {
 		if msgType == -1 {
-			return false, errors.New(response.Error)
+			return false, stop, errors.New(response.Error)
 		} else {
 			_, err := p.sender.SendGroupTextMsg(group, response.Error)
-			return err == nil, err
+			return err == nil, stop, err
 		}
 	}
 
 	switch int(msgType) {
 	case -1:
-		return false, nil
+		return false, stop, nil
 	case 0:
-		return true, nil
+		return true, stop, nil
 	case 1:
 		_, err := p.sender.SendGroupTextMsg(group, response.Body)
-		return err == nil, err
+		return err == nil, stop, err
 	default:
 		_, err := p.sender.SendGroupMediaMsg(group, int(msgType), response.Body, response.Filename, response.Prompt)
-		return err == nil, err
+		return err == nil, stop, err
 	}
 }
 
 type (
 	remotePluginInfo struct {
-		Keyword     string `json:"keyword"`
-		Description string `json:"description"`
+		Keyword     string        `json:"keyword"`
+		Description string        `json:"description"`
+		Usage       string        `json:"usage"`
+		Examples    []string      `json:"examples"`
+		Args        []Arg         `json:"args"`
+		Config      []ConfigField `json:"config"`
+		Jobs        []remoteJob   `json:"jobs"`      // 定时任务，到期时回调插件接口
+		Events      []string      `json:"events"`    // 订阅的事件
+		Subscribe   bool          `json:"subscribe"` // 是否订阅群内所有消息
+		Priority    int           `json:"priority"`  // 订阅消息的处理顺序，越小越先处理
+	}
+	remoteJob struct {
+		Name string `json:"name"`
+		Spec string `json:"spec"` // cron表达式
+	}
+	remoteEventRequest struct {
+		Event event.Event `json:"event"`
+	}
+	remoteJobRequest struct {
+		Job  string `json:"job"` // 定时任务名称
+		Time int64  `json:"time"`
 	}
 	remotePluginRequest struct {
-		MsgID      string `json:"msgID"`
-		UID        string `json:"uid"`
-		Username   string `json:"username"`
-		GID        string `json:"gid"`
-		GroupName  string `json:"groupName"`
-		Message    string `json:"message"`
-		RawMessage string `json:"rawMessage"`
-		MsgType    int    `json:"msgType"`
-		Time       int64  `json:"time"`
+		MsgID      string            `json:"msgID"`
+		UID        string            `json:"uid"`
+		Username   string            `json:"username"`
+		GID        string            `json:"gid"`
+		GroupName  string            `json:"groupName"`
+		Message    string            `json:"message"`
+		RawMessage string            `json:"rawMessage"`
+		MsgType    int               `json:"msgType"`
+		Time       int64             `json:"time"`
+		Session    bool              `json:"session"`            // 消息是否来自会话
+		Mentions   []string          `json:"mentions,omitempty"` // @的群成员id
+		Hook       bool              `json:"hook"`               // 消息是否来自订阅，而非唤醒词调用
+		Config     map[string]string `json:"config,omitempty"`   // 插件配置
 	}
 	remotePluginResponse struct {
 		Error    string      `json:"error"`    // 错误信息，空表示没错误
@@ -186,5 +301,7 @@ type (
 		Body     string      `json:"body"`     // 回复内容,type=1时为文本内容,type=2/3/4时为资源地址
 		Filename string      `json:"filename"` // 文件名称
 		Prompt   string      `json:"prompt"`   // 发送媒体资源前的提示词,会自动撤回
+		Session  int         `json:"session"`  // 会话操作 >0:占用会话的秒数,<0:释放会话,0:不变
+		Stop     bool        `json:"stop"`     // 订阅消息时是否中止后续处理
 	}
 )
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"testing"
+)
+
+// lifecyclePlugin 记录初始化和销毁的插件
+type lifecyclePlugin struct {
+	stubPlugin
+	name    string
+	initErr error
+	events  *[]string
+}
+
+func (p *lifecyclePlugin) Keyword(...string) string {
+	return ""
+}
+
+func (p *lifecyclePlugin) Init(*gorm.DB) error {
+	*p.events = append(*p.events, "init "+p.name)
+	return p.initErr
+}
+
+func (p *lifecyclePlugin) Destroy(*gorm.DB) error {
+	*p.events = append(*p.events, "destroy "+p.name)
+	return nil
+}
+
+func TestReplace(t *testing.T) {
+	var events []string
+	m := new(Manager)
+	m.BeanConstruct(nil)
+	old := &lifecyclePlugin{stubPlugin: stubPlugin{id: "demo"}, name: "old", events: &events}
+	m.loaded["demo"] = old
+
+	// 新实例初始化失败时恢复旧实例，不执行保存
+	broken := &lifecyclePlugin{stubPlugin: stubPlugin{id: "demo"}, name: "broken", initErr: errors.New("初始化失败"), events: &events}
+	saved := false
+	if err := m.replace("demo", broken, func() error { saved = true; return nil }); err == nil {
+		t.Fatal("初始化失败时应返回错误")
+	}
+	if saved || m.loaded["demo"] != old {
+		t.Fatal("初始化失败时应保留旧实例且不保存")
+	}
+	assertEvents(t, &events, "destroy old", "init broken", "init old")
+
+	// 保存失败时销毁新实例并恢复旧实例
+	unsaved := &lifecyclePlugin{stubPlugin: stubPlugin{id: "demo"}, name: "unsaved", events: &events}
+	if err := m.replace("demo", unsaved, func() error { return errors.New("保存失败") }); err == nil {
+		t.Fatal("保存失败时应返回错误")
+	}
+	if m.loaded["demo"] != old {
+		t.Fatal("保存失败时应保留旧实例")
+	}
+	assertEvents(t, &events, "destroy old", "init unsaved", "destroy unsaved", "init old")
+
+	// 替换成功
+	updated := &lifecyclePlugin{stubPlugin: stubPlugin{id: "demo"}, name: "new", events: &events}
+	if err := m.replace("demo", updated, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if m.loaded["demo"] != updated {
+		t.Fatal("替换成功后应使用新实例")
+	}
+	assertEvents(t, &events, "destroy old", "init new")
+
+	// 未加载的插件只执行保存
+	idle := &lifecyclePlugin{stubPlugin: stubPlugin{id: "idle"}, name: "idle", events: &events}
+	if err := m.replace("idle", idle, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.loaded["idle"]; ok {
+		t.Fatal("未加载的插件替换后不应加载")
+	}
+	assertEvents(t, &events)
+}
+
+func assertEvents(t *testing.T, events *[]string, want ...string) {
+	t.Helper()
+	if len(*events) != len(want) {
+		t.Fatalf("期望%v, 实际%v", want, *events)
+	}
+	for i := range want {
+		if (*events)[i] != want[i] {
+			t.Fatalf("期望%v, 实际%v", want, *events)
+		}
+	}
+	*events = nil
+}
@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"errors"
+	"github.com/eatmoreapple/openwechat"
+	"log"
+	"strings"
+)
+
+// contextGroup 消息所在的群，非群消息或ctx为空时返回空
+func contextGroup(ctx *openwechat.MessageContext) *openwechat.User {
+	if ctx == nil {
+		return nil
+	}
+	sender, err := ctx.Sender()
+	if err != nil || !sender.IsGroup() {
+		return nil
+	}
+	return sender
+}
+
+// contextScope 群绑定使用的范围，按群名称记录，避免重新登录后群id变化导致绑定失效
+func contextScope(ctx *openwechat.MessageContext) (string, error) {
+	group := contextGroup(ctx)
+	if group == nil || group.NickName == "" {
+		return "", errors.New("只能在群内绑定插件到当前群")
+	}
+	return group.NickName, nil
+}
+
+// matchScope 判断绑定范围是否为指定群
+func matchScope(scope string, group *openwechat.User) bool {
+	if scope == "" || group == nil {
+		return false
+	}
+	return strings.EqualFold(scope, group.NickName) || strings.EqualFold(scope, group.UserName)
+}
+
+// resolve 查找唤醒词在群内生效的绑定，调用方需持有读锁
+func (m *Manager) resolve(group *openwechat.User, keyword string) (bindKey, bool) {
+	global := bindKey{keyword: keyword}
+	for key := range m.bindMap {
+		if key.keyword == keyword && matchScope(key.scope, group) {
+			return key, true
+		}
+	}
+	_, ok := m.bindMap[global]
+	return global, ok
+}
+
+// bindings 群内生效的唤醒词绑定，群绑定覆盖同名的全局绑定，调用方需持有读锁
+func (m *Manager) bindings(group *openwechat.User) map[string]bindKey {
+	bindings := map[string]bindKey{}
+	for key := range m.bindMap {
+		if key.scope == "" {
+			if _, exist := bindings[key.keyword]; !exist {
+				bindings[key.keyword] = key
+			}
+		} else if matchScope(key.scope, group) {
+			bindings[key.keyword] = key
+		}
+	}
+	return bindings
+}
+
+// migrateBind 旧版绑定表的主键不包含范围，补充范围字段后重建表。
+// mysql中建表删表会隐式提交事务，先复制到新表再重命名，迁移失败时保留旧表
+func (m *Manager) migrateBind() error {
+	migrator := m.DB.Migrator()
+	if !migrator.HasTable(&AddonBind{}) || migrator.HasColumn(&AddonBind{}, "scope") {
+		return nil
+	}
+	const (
+		table       = "addon_binds"
+		migrating   = "addon_binds_migrating"
+		legacyTable = "addon_binds_legacy"
+	)
+	var records []AddonBind
+	if err := m.DB.Table(table).Select("id", "keyword").Find(&records).Error; err != nil {
+		return err
+	}
+	// 清理上次迁移失败留下的新表
+	if err := migrator.DropTable(migrating); err != nil {
+		return err
+	}
+	if err := m.DB.Table(migrating).AutoMigrate(&AddonBind{}); err != nil {
+		return err
+	}
+	if len(records) > 0 {
+		if err := m.DB.Table(migrating).Create(&records).Error; err != nil {
+			return err
+		}
+	}
+	if err := migrator.RenameTable(table, legacyTable); err != nil {
+		return err
+	}
+	if err := migrator.RenameTable(migrating, table); err != nil {
+		// 恢复旧表
+		if e := migrator.RenameTable(legacyTable, table); e != nil {
+			log.Println("恢复插件绑定表出错", e)
+		}
+		return err
+	}
+	return migrator.DropTable(legacyTable)
+}
@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestResolveBinding(t *testing.T) {
+	m := &Manager{bindMap: map[bindKey]string{
+		{keyword: "天气"}:               "weather",
+		{scope: "测试群", keyword: "天气"}: "weather2",
+		{scope: "测试群", keyword: "翻译"}: "translate",
+	}}
+	group := &openwechat.User{UserName: "@@group", NickName: "测试群"}
+	other := &openwechat.User{UserName: "@@other", NickName: "其他群"}
+	cases := []struct {
+		group   *openwechat.User
+		keyword string
+		id      string
+	}{
+		{group, "天气", "weather2"},
+		{other, "天气", "weather"},
+		{nil, "天气", "weather"},
+		{group, "翻译", "translate"},
+		{other, "翻译", ""},
+	}
+	for _, c := range cases {
+		key, ok := m.resolve(c.group, c.keyword)
+		if id := m.bindMap[key]; (ok && id != c.id) || (!ok && c.id != "") {
+			t.Errorf("%v %s: 期望%s, 实际%s", c.group, c.keyword, c.id, id)
+		}
+	}
+	if bindings := m.bindings(group); len(bindings) != 2 || bindings["天气"].scope != "测试群" {
+		t.Fatalf("群内绑定错误 %v", bindings)
+	}
+	if bindings := m.bindings(other); len(bindings) != 1 {
+		t.Fatalf("其他群绑定错误 %v", bindings)
+	}
+}
+
+func TestMigrateBind(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type legacyBind struct {
+		ID      string `gorm:"primaryKey"`
+		Keyword string `gorm:"primaryKey"`
+	}
+	if err := db.Table("addon_binds").AutoMigrate(&legacyBind{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Table("addon_binds").Create(&legacyBind{ID: "weather", Keyword: "天气"})
+	m := &Manager{DB: db}
+	if err := m.migrateBind(); err != nil {
+		t.Fatal(err)
+	}
+	if db.Migrator().HasTable("addon_binds_migrating") || db.Migrator().HasTable("addon_binds_legacy") {
+		t.Fatal("迁移后未清理临时表")
+	}
+	if err := db.Create(&AddonBind{ID: "weather", Keyword: "天气", Scope: "测试群"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var records []AddonBind
+	db.Find(&records)
+	if len(records) != 2 || records[0].Scope != "" {
+		t.Fatalf("迁移结果错误 %v", records)
+	}
+}
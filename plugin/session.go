@@ -0,0 +1,117 @@
+package plugin
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// sessionState 会话状态
+	sessionState struct {
+		pluginId string
+		keyword  string
+		timeout  time.Duration
+		expires  time.Time
+		data     map[string]interface{}
+	}
+
+	// sessionStore 会话存储，以群id和用户id为键
+	sessionStore struct {
+		mutex    sync.Mutex
+		sessions map[string]*sessionState
+	}
+
+	// sessionHandle 提供给插件的会话操作对象
+	sessionHandle struct {
+		store    *sessionStore
+		key      string
+		pluginId string
+		keyword  string
+		active   bool
+	}
+)
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: map[string]*sessionState{}}
+}
+
+func sessionKey(gid string, uid string) string {
+	return gid + ":" + uid
+}
+
+// get 获取未过期的会话，过期会话会被清除
+func (s *sessionStore) get(key string) *sessionState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	state, ok := s.sessions[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(state.expires) {
+		delete(s.sessions, key)
+		return nil
+	}
+	return state
+}
+
+// touch 刷新会话过期时间
+func (s *sessionStore) touch(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if state, ok := s.sessions[key]; ok {
+		state.expires = time.Now().Add(state.timeout)
+	}
+}
+
+// releasePlugin 释放插件占用的全部会话
+func (s *sessionStore) releasePlugin(pluginId string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, state := range s.sessions {
+		if state.pluginId == pluginId {
+			delete(s.sessions, key)
+		}
+	}
+}
+
+func (h *sessionHandle) Claim(timeout time.Duration) {
+	h.store.mutex.Lock()
+	defer h.store.mutex.Unlock()
+	state, ok := h.store.sessions[h.key]
+	if !ok || state.pluginId != h.pluginId {
+		state = &sessionState{pluginId: h.pluginId, keyword: h.keyword, data: map[string]interface{}{}}
+		h.store.sessions[h.key] = state
+	}
+	state.timeout = timeout
+	state.expires = time.Now().Add(timeout)
+}
+
+func (h *sessionHandle) Release() {
+	h.store.mutex.Lock()
+	defer h.store.mutex.Unlock()
+	if state, ok := h.store.sessions[h.key]; ok && state.pluginId == h.pluginId {
+		delete(h.store.sessions, h.key)
+	}
+}
+
+func (h *sessionHandle) Active() bool {
+	return h.active
+}
+
+func (h *sessionHandle) Get(key string) (interface{}, bool) {
+	h.store.mutex.Lock()
+	defer h.store.mutex.Unlock()
+	if state, ok := h.store.sessions[h.key]; ok && state.pluginId == h.pluginId {
+		v, ok := state.data[key]
+		return v, ok
+	}
+	return nil, false
+}
+
+func (h *sessionHandle) Set(key string, value interface{}) {
+	h.store.mutex.Lock()
+	defer h.store.mutex.Unlock()
+	if state, ok := h.store.sessions[h.key]; ok && state.pluginId == h.pluginId {
+		state.data[key] = value
+	}
+}
@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionClaimRelease(t *testing.T) {
+	store := newSessionStore()
+	key := sessionKey("@@group", "@user")
+	first := &sessionHandle{store: store, key: key, pluginId: "first", keyword: "猜数"}
+	second := &sessionHandle{store: store, key: key, pluginId: "second", keyword: "问答"}
+
+	first.Set("answer", 1)
+	if _, ok := first.Get("answer"); ok {
+		t.Fatal("未占用会话时不应保存数据")
+	}
+	first.Claim(time.Minute)
+	first.Set("answer", 42)
+	if state := store.get(key); state == nil || state.pluginId != "first" || state.keyword != "猜数" {
+		t.Fatalf("期望会话被first占用, 实际%v", state)
+	}
+	if v, ok := first.Get("answer"); !ok || v != 42 {
+		t.Fatalf("期望读取会话数据, 实际%v %v", v, ok)
+	}
+	// 其他插件不能读取或释放会话
+	if _, ok := second.Get("answer"); ok {
+		t.Fatal("其他插件不应读取会话数据")
+	}
+	second.Release()
+	if store.get(key) == nil {
+		t.Fatal("其他插件不应释放会话")
+	}
+	// 重复占用保留会话数据
+	first.Claim(time.Minute)
+	if v, _ := first.Get("answer"); v != 42 {
+		t.Fatal("重复占用不应清除会话数据")
+	}
+	first.Release()
+	if store.get(key) != nil {
+		t.Fatal("释放后不应存在会话")
+	}
+	// 其他插件占用后数据重新开始
+	second.Claim(time.Minute)
+	if _, ok := second.Get("answer"); ok {
+		t.Fatal("新占用的会话不应包含之前的数据")
+	}
+}
+
+func TestSessionExpire(t *testing.T) {
+	store := newSessionStore()
+	key := sessionKey("@@group", "@user")
+	handle := &sessionHandle{store: store, key: key, pluginId: "demo"}
+	handle.Claim(20 * time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	store.touch(key)
+	time.Sleep(15 * time.Millisecond)
+	if store.get(key) == nil {
+		t.Fatal("刷新后的会话不应过期")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if store.get(key) != nil {
+		t.Fatal("超时的会话应被清除")
+	}
+
+	handle.Claim(time.Minute)
+	other := sessionKey("@@group", "@other")
+	(&sessionHandle{store: store, key: other, pluginId: "demo"}).Claim(time.Minute)
+	store.releasePlugin("demo")
+	if store.get(key) != nil || store.get(other) != nil {
+		t.Fatal("卸载插件应释放其全部会话")
+	}
+}
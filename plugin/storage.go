@@ -0,0 +1,135 @@
+package plugin
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+	"wechat-assistant/kv"
+)
+
+// AddonStorage 插件键值存储
+type AddonStorage struct {
+	ID       uint   `gorm:"primaryKey;autoIncrement"`
+	AddonID  string `gorm:"index:idx_addon_storage,unique;type:varchar(100)"` // 插件id
+	Scope    string `gorm:"index:idx_addon_storage,unique;type:varchar(200)"` // 作用域,为空时为插件全局
+	Key      string `gorm:"index:idx_addon_storage,unique;type:varchar(255)"` // 键
+	Value    string `gorm:"type:text"`                                        // 值
+	ExpireAt int64  `gorm:"type:bigint"`                                      // 过期时间,单位毫秒,0表示不过期
+}
+
+var errNoGroup = errors.New("当前消息不在群聊中")
+
+// storage 插件键值存储的实现
+type storage struct {
+	db       *gorm.DB
+	pluginId string
+	scope    string
+	// 群名称和群成员昵称，群id和成员id在重新登录后会变化
+	groupName string
+	userName  string
+	err       error
+}
+
+func newStorage(db *gorm.DB, pluginId string, groupName string, userName string) kv.Store {
+	return &storage{db: db, pluginId: pluginId, groupName: groupName, userName: userName}
+}
+
+func (s *storage) scoped(scope string) kv.Store {
+	scopedStorage := *s
+	scopedStorage.scope = scope
+	if s.groupName == "" {
+		scopedStorage.err = errNoGroup
+	}
+	return &scopedStorage
+}
+
+func (s *storage) Group() kv.Store {
+	return s.scoped("g:" + s.groupName)
+}
+
+func (s *storage) User() kv.Store {
+	return s.scoped("u:" + s.groupName + ":" + s.userName)
+}
+
+func (s *storage) query() *gorm.DB {
+	return s.db.Model(&AddonStorage{}).Where("addon_id = ? and scope = ?", s.pluginId, s.scope)
+}
+
+func (s *storage) Get(key string) (string, bool, error) {
+	if s.err != nil {
+		return "", false, s.err
+	}
+	item := new(AddonStorage)
+	if err := s.query().Where("`key` = ?", key).Limit(1).Find(item).Error; err != nil {
+		return "", false, err
+	} else if item.ID == 0 {
+		return "", false, nil
+	}
+	if item.ExpireAt > 0 && item.ExpireAt <= time.Now().UnixMilli() {
+		// 过期数据读取时清除
+		s.db.Delete(item)
+		return "", false, nil
+	}
+	return item.Value, true, nil
+}
+
+func (s *storage) Set(key string, value string, ttl time.Duration) error {
+	if s.err != nil {
+		return s.err
+	}
+	if key == "" {
+		return errors.New("键不能为空")
+	}
+	var expireAt int64
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl).UnixMilli()
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "addon_id"}, {Name: "scope"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "expire_at"}),
+	}).Create(&AddonStorage{
+		AddonID:  s.pluginId,
+		Scope:    s.scope,
+		Key:      key,
+		Value:    value,
+		ExpireAt: expireAt,
+	}).Error
+}
+
+func (s *storage) Delete(key string) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.query().Where("`key` = ?", key).Delete(&AddonStorage{}).Error
+}
+
+func (s *storage) List(prefix string) (map[string]string, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	now := time.Now().UnixMilli()
+	// 清除已过期的数据
+	if err := s.query().Where("expire_at > 0 and expire_at <= ?", now).Delete(&AddonStorage{}).Error; err != nil {
+		return nil, err
+	}
+	var items []AddonStorage
+	tx := s.query()
+	if prefix != "" {
+		tx = tx.Where("`key` like ? escape '!'", escapeLike(prefix)+"%")
+	}
+	if err := tx.Find(&items).Error; err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(items))
+	for _, item := range items {
+		values[item.Key] = item.Value
+	}
+	return values, nil
+}
+
+// escapeLike 转义like中的通配符，使用!作为转义字符以兼容mysql和sqlite
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestStorage(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&AddonStorage{}); err != nil {
+		t.Fatal(err)
+	}
+	store := newStorage(db, "demo", "group", "user")
+	if err := store.Set("count", "1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("count", "2", 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := store.Get("count"); err != nil || !ok || v != "2" {
+		t.Fatalf("期望2, 实际%s %v %v", v, ok, err)
+	}
+	// 不同作用域和插件之间隔离
+	if _, ok, _ := store.Group().Get("count"); ok {
+		t.Fatal("群作用域不应读取到插件全局数据")
+	}
+	if _, ok, _ := newStorage(db, "other", "group", "user").Get("count"); ok {
+		t.Fatal("其他插件不应读取到数据")
+	}
+	_ = store.User().Set("a_1", "x", 0)
+	_ = store.User().Set("ab", "y", 0)
+	_ = store.User().Set("a_2", "z", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	values, err := store.User().List("a_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || values["a_1"] != "x" {
+		t.Fatalf("前缀查询结果错误 %v", values)
+	}
+	if err := store.Delete("count"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.Get("count"); ok {
+		t.Fatal("删除后不应读取到数据")
+	}
+	if err := newStorage(db, "demo", "", "").Group().Set("k", "v", 0); err != errNoGroup {
+		t.Fatalf("期望%v, 实际%v", errNoGroup, err)
+	}
+}
@@ -0,0 +1,213 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eatmoreapple/openwechat"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout 插件默认执行超时时间
+	DefaultTimeout = 30 * time.Second
+	// timeoutLimit 连续超时达到次数后自动停用插件
+	timeoutLimit = 3
+)
+
+// ErrTimeout 插件执行超时
+var ErrTimeout = errors.New("处理超时")
+
+// timedOutKey 消息上下文中标记已有插件调用超时的key
+const timedOutKey = "pluginTimedOut"
+
+// Invocation 超时后仍未结束的插件调用
+type Invocation struct {
+	PluginID string
+	Keyword  string
+	Start    time.Time
+}
+
+type invokeResult struct {
+	ok  bool
+	err error
+}
+
+// watchdog 记录超时未结束的调用和插件连续超时次数
+type watchdog struct {
+	mutex    sync.Mutex
+	seq      uint64
+	stuck    map[uint64]Invocation
+	failures map[string]int
+}
+
+func newWatchdog() *watchdog {
+	return &watchdog{
+		stuck:    map[uint64]Invocation{},
+		failures: map[string]int{},
+	}
+}
+
+// timeout 记录超时调用，返回连续超时次数
+func (w *watchdog) timeout(invocation Invocation, done <-chan invokeResult) int {
+	w.mutex.Lock()
+	w.seq++
+	id := w.seq
+	w.stuck[id] = invocation
+	w.failures[invocation.PluginID]++
+	failures := w.failures[invocation.PluginID]
+	w.mutex.Unlock()
+	go func() {
+		<-done
+		w.mutex.Lock()
+		delete(w.stuck, id)
+		w.mutex.Unlock()
+		log.Println("超时的插件调用已结束", invocation.PluginID, time.Since(invocation.Start))
+	}()
+	return failures
+}
+
+func (w *watchdog) succeed(pluginId string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	delete(w.failures, pluginId)
+}
+
+// list 超时未结束的调用，按开始时间排序
+func (w *watchdog) list() []Invocation {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	invocations := make([]Invocation, 0, len(w.stuck))
+	for _, invocation := range w.stuck {
+		invocations = append(invocations, invocation)
+	}
+	sort.Slice(invocations, func(i, j int) bool {
+		return invocations[i].Start.Before(invocations[j].Start)
+	})
+	return invocations
+}
+
+// timeoutOf 插件的执行超时时间
+func (m *Manager) timeoutOf(id string) time.Duration {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if timeout, ok := m.timeouts[id]; ok && timeout > 0 {
+		return timeout
+	}
+	return DefaultTimeout
+}
+
+// execute 在超时时间内执行插件调用，超时后调用在后台继续运行并记录，连续超时的插件会被停用。
+// 定时任务和事件没有消息上下文，ctx为空
+func (m *Manager) execute(plugin Plugin, keyword string, ctx *openwechat.MessageContext, fn func() (bool, error)) (bool, error) {
+	id := plugin.ID()
+	if m.isDisabled(id) {
+		return false, fmt.Errorf("插件%s因多次超时已停用", id)
+	}
+	c, cancel := context.WithTimeout(context.Background(), m.timeoutOf(id))
+	defer cancel()
+	if ctx != nil {
+		ctx.Set("context", c)
+	}
+	done := make(chan invokeResult, 1)
+	start := time.Now()
+	go func() {
+		var result invokeResult
+		defer func() {
+			if e := recover(); e != nil {
+				result = invokeResult{err: recoverError(e, keyword)}
+			}
+			done <- result
+		}()
+		result.ok, result.err = fn()
+	}()
+	select {
+	case result := <-done:
+		m.watchdog.succeed(id)
+		return result.ok, result.err
+	case <-c.Done():
+		failures := m.watchdog.timeout(Invocation{PluginID: id, Keyword: keyword, Start: start}, done)
+		log.Println("插件执行超时", id, keyword, failures)
+		// 超时的调用仍持有上下文，后续插件不能再复用，避免读取到其他插件的配置和权限
+		if ctx != nil {
+			ctx.Set(timedOutKey, true)
+		}
+		if failures >= timeoutLimit {
+			m.disable(id, ctx)
+		}
+		return false, ErrTimeout
+	}
+}
+
+// timedOut 消息上下文中是否已有插件调用超时
+func timedOut(ctx *openwechat.MessageContext) bool {
+	value, _ := ctx.Get(timedOutKey)
+	timedOut, _ := value.(bool)
+	return timedOut
+}
+
+func recoverError(e interface{}, keyword string) error {
+	switch e.(type) {
+	case error:
+		return e.(error)
+	case string:
+		return errors.New(e.(string))
+	default:
+		return errors.New("插件调用出错:" + keyword)
+	}
+}
+
+func (m *Manager) isDisabled(id string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.disabled[id]
+}
+
+// disable 停用连续超时的插件并通知管理员，没有消息上下文时只记录日志
+func (m *Manager) disable(id string, ctx *openwechat.MessageContext) {
+	m.mutex.Lock()
+	m.disabled[id] = true
+	m.mutex.Unlock()
+	if err := m.DB.Model(&Addon{}).Where("id = ?", id).Update("disabled", true).Error; err != nil {
+		log.Println("停用插件出错", id, err)
+	}
+	log.Println("插件连续超时已停用", id)
+	if ctx == nil {
+		return
+	}
+	m.Admin.NotifyAdmins(ctx, fmt.Sprintf("插件%s连续%d次执行超时，已自动停用，恢复请发送 #插件 验证码 enable %s", id, timeoutLimit, id))
+}
+
+// Enable 启用被停用的插件
+func (m *Manager) Enable(id string) error {
+	if err := m.DB.Model(&Addon{}).Where("id = ?", id).Update("disabled", false).Error; err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	delete(m.disabled, id)
+	m.mutex.Unlock()
+	m.watchdog.succeed(id)
+	return nil
+}
+
+// SetTimeout 设置插件执行超时时间，0表示使用默认值
+func (m *Manager) SetTimeout(id string, timeout time.Duration) error {
+	res := m.DB.Model(&Addon{}).Where("id = ?", id).Update("timeout", int(timeout/time.Second))
+	if res.Error != nil {
+		return res.Error
+	} else if res.RowsAffected == 0 {
+		return fmt.Errorf("插件%s不存在", id)
+	}
+	m.mutex.Lock()
+	m.timeouts[id] = timeout
+	m.mutex.Unlock()
+	return nil
+}
+
+// Stuck 超时后仍未结束的插件调用
+func (m *Manager) Stuck() []Invocation {
+	return m.watchdog.list()
+}
@@ -0,0 +1,66 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"github.com/eatmoreapple/openwechat"
+	"testing"
+	"time"
+)
+
+type stubPlugin struct {
+	Plugin
+	id string
+}
+
+func (p stubPlugin) ID() string {
+	return p.id
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	m := &Manager{
+		watchdog: newWatchdog(),
+		timeouts: map[string]time.Duration{"slow": 20 * time.Millisecond},
+		disabled: map[string]bool{},
+	}
+	ctx := &openwechat.MessageContext{Message: &openwechat.Message{}}
+	release := make(chan struct{})
+	_, err := m.execute(stubPlugin{id: "slow"}, "慢", ctx, func() (bool, error) {
+		<-release
+		return true, nil
+	})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("期望超时, 实际%v", err)
+	}
+	if stuck := m.Stuck(); len(stuck) != 1 || stuck[0].PluginID != "slow" {
+		t.Fatalf("期望记录超时调用, 实际%v", stuck)
+	}
+	if err := m.prepare(stubPlugin{id: "next"}, "下一个", nil, ctx, false); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("超时后不应复用上下文, 实际%v", err)
+	}
+	close(release)
+	for i := 0; len(m.Stuck()) > 0; i++ {
+		if i > 100 {
+			t.Fatal("超时调用结束后未清理")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ok, err := m.execute(stubPlugin{id: "fast"}, "快", ctx, func() (bool, error) {
+		value, _ := ctx.Get("context")
+		if _, ok := value.(context.Context).Deadline(); !ok {
+			return false, errors.New("缺少截止时间")
+		}
+		return true, nil
+	})
+	if !ok || err != nil {
+		t.Fatalf("期望调用成功, 实际%v %v", ok, err)
+	}
+
+	_, err = m.execute(stubPlugin{id: "panic"}, "异常", ctx, func() (bool, error) {
+		panic("插件异常")
+	})
+	if err == nil || err.Error() != "插件异常" {
+		t.Fatalf("期望捕获异常, 实际%v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package plugin
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// AddonVersion 插件历史版本
+type AddonVersion struct {
+	ID      uint   `gorm:"primaryKey;autoIncrement"`
+	AddonID string `gorm:"index:idx_addon_version,unique;type:varchar(255)"` // 插件id
+	Version int    `gorm:"index:idx_addon_version,unique"`                   // 版本号,从1开始递增
+	Hash    string `gorm:"type:varchar(32)"`                                 // 代码哈希
+	Package string ``                                                        // 包名
+	Src     string ``                                                        // 路径
+	Code    string ``                                                        // 加载内容
+	Time    int64  `gorm:"type:int(13)"`
+}
+
+func (v AddonVersion) String() string {
+	return fmt.Sprintf("v%d %s %s %s", v.Version, v.Hash[:8], time.Unix(v.Time, 0).Format("2006-01-02 15:04"), v.Src)
+}
+
+func codeHash(code string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(code)))
+}
+
+// saveVersion 记录插件版本，代码与最新版本相同时不重复记录，返回当前版本号
+func saveVersion(db *gorm.DB, addon Addon) (int, error) {
+	latest := new(AddonVersion)
+	if err := db.Where("addon_id = ?", addon.ID).Order("version desc").Limit(1).Find(latest).Error; err != nil {
+		return 0, err
+	}
+	hash := codeHash(addon.Code)
+	if latest.ID != 0 && latest.Hash == hash {
+		return latest.Version, nil
+	}
+	version := AddonVersion{
+		AddonID: addon.ID,
+		Version: latest.Version + 1,
+		Hash:    hash,
+		Package: addon.Package,
+		Src:     addon.Src,
+		Code:    addon.Code,
+		Time:    time.Now().Unix(),
+	}
+	if err := db.Create(&version).Error; err != nil {
+		return 0, err
+	}
+	return version.Version, nil
+}
+
+// Versions 查询插件的历史版本，按版本号倒序
+func (m *Manager) Versions(id string) ([]AddonVersion, error) {
+	var versions []AddonVersion
+	err := m.DB.Where("addon_id = ?", id).Order("version desc").Find(&versions).Error
+	return versions, err
+}
+
+// Rollback 将插件恢复到指定版本并重新加载，version为0时恢复到当前版本的上一个版本
+func (m *Manager) Rollback(id string, version int) (*AddonVersion, error) {
+	addon := new(Addon)
+	if err := m.DB.First(addon, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("插件%s不存在", id)
+		}
+		return nil, errors.New("获取插件信息出错")
+	}
+	target := new(AddonVersion)
+	tx := m.DB.Where("addon_id = ?", id)
+	if version > 0 {
+		tx = tx.Where("version = ?", version)
+	} else {
+		tx = tx.Where("version < ?", addon.Version).Order("version desc")
+	}
+	if err := tx.Limit(1).Find(target).Error; err != nil {
+		return nil, errors.New("获取插件版本出错")
+	} else if target.ID == 0 {
+		return nil, errors.New("未找到可恢复的版本")
+	}
+	addon.Package = target.Package
+	addon.Src = target.Src
+	addon.Code = target.Code
+	addon.Version = target.Version
+	// 先编译历史版本，编译失败时不做任何修改
+	plugin, err := m.newPlugin(*addon)
+	if err != nil {
+		return nil, errors.New("编译插件出错:" + err.Error())
+	}
+	addon.Info = plugin.Info()
+	if err := m.replace(id, plugin, func() error { return m.DB.Save(addon).Error }); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
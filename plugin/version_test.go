@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+const versionCode = `package versiondemo
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"gorm.io/gorm"
+)
+
+func Handle(db *gorm.DB, ctx *openwechat.MessageContext) (bool, error) {
+	_, err := ctx.ReplyText("%s")
+	return true, err
+}
+`
+
+func TestVersionRollback(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Addon{}, &AddonVersion{}); err != nil {
+		t.Fatal(err)
+	}
+	addon := Addon{Info: Info{ID: "versiondemo", Package: "versiondemo", Code: fmt.Sprintf(versionCode, "v1")}}
+	for i, code := range []string{"v1", "v1", "v2", "v3"} {
+		addon.Code = fmt.Sprintf(versionCode, code)
+		if addon.Version, err = saveVersion(db, addon); err != nil {
+			t.Fatal(err)
+		}
+		// 代码未变化时不重复记录
+		if want := []int{1, 1, 2, 3}[i]; addon.Version != want {
+			t.Fatalf("期望版本%d, 实际%d", want, addon.Version)
+		}
+	}
+	if err := db.Create(&addon).Error; err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{DB: db}
+	versions, err := m.Versions("versiondemo")
+	if err != nil || len(versions) != 3 || versions[0].Version != 3 {
+		t.Fatalf("期望3个版本倒序排列, 实际%v %v", versions, err)
+	}
+
+	// 未指定版本时恢复到上一个版本
+	target, err := m.Rollback("versiondemo", 0)
+	if err != nil || target.Version != 2 {
+		t.Fatalf("期望恢复到v2, 实际%v %v", target, err)
+	}
+	current := new(Addon)
+	db.First(current, "id = ?", "versiondemo")
+	if current.Version != 2 || current.Code != fmt.Sprintf(versionCode, "v2") {
+		t.Fatalf("恢复后的插件代码错误 v%d", current.Version)
+	}
+	if target, err := m.Rollback("versiondemo", 1); err != nil || target.Version != 1 {
+		t.Fatalf("期望恢复到v1, 实际%v %v", target, err)
+	}
+	if _, err := m.Rollback("versiondemo", 0); err == nil {
+		t.Fatal("没有更早的版本时应返回错误")
+	}
+	if _, err := m.Rollback("versiondemo", 9); err == nil {
+		t.Fatal("不存在的版本应返回错误")
+	}
+	if _, err := m.Rollback("unknown", 0); err == nil {
+		t.Fatal("不存在的插件应返回错误")
+	}
+}
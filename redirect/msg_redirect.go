@@ -7,20 +7,42 @@ type (
 		SetCommandHandler(func(BotCommand))
 	}
 	Message struct {
-		MsgID      string  `json:"msgID"`
-		UID        string  `json:"uid"`
-		Username   string  `json:"username"`
-		GID        string  `json:"gid"`
-		GroupName  string  `json:"groupName"`
-		RawMessage string  `json:"rawMessage,omitempty"`
-		MsgType    int     `json:"msgType"`
-		Time       int64   `json:"time"`
-		Quote      *Quote  `json:"quote,omitempty"`
-		Revoke     *Revoke `json:"revoke,omitempty"`
+		MsgID      string   `json:"msgID"`
+		UID        string   `json:"uid"`
+		Username   string   `json:"username"`
+		GID        string   `json:"gid"`
+		GroupName  string   `json:"groupName"`
+		RawMessage string   `json:"rawMessage,omitempty"`
+		MsgType    int      `json:"msgType"`
+		Time       int64    `json:"time"`
+		Quote      *Quote   `json:"quote,omitempty"`
+		Revoke     *Revoke  `json:"revoke,omitempty"`
+		Payload    *Payload `json:"payload,omitempty"`
+		Mentions   []string `json:"mentions,omitempty"` // @的群成员id
 	}
 	Quote struct {
-		UID   string `json:"uid"`
-		Quote string `json:"quote"`
+		UID     string `json:"uid"`
+		Quote   string `json:"quote"`
+		MsgID   string `json:"msgID,omitempty"`   // 被引用消息id
+		MsgType int    `json:"msgType,omitempty"` // 被引用消息类型
+	}
+	// Payload 链接、小程序、文件、名片、位置等消息的结构化内容
+	Payload struct {
+		Kind        string  `json:"kind"`                  // 类型 link/miniprogram/file/card/location/app
+		Title       string  `json:"title,omitempty"`       // 标题或文件名
+		Description string  `json:"description,omitempty"` // 描述
+		URL         string  `json:"url,omitempty"`         // 链接地址
+		AppName     string  `json:"appName,omitempty"`     // 来源应用或小程序名称
+		AppID       string  `json:"appID,omitempty"`       // 小程序appid
+		PagePath    string  `json:"pagePath,omitempty"`    // 小程序页面路径
+		FileExt     string  `json:"fileExt,omitempty"`     // 文件扩展名
+		FileSize    int64   `json:"fileSize,omitempty"`    // 文件大小
+		Latitude    float64 `json:"latitude,omitempty"`    // 纬度
+		Longitude   float64 `json:"longitude,omitempty"`   // 经度
+		Label       string  `json:"label,omitempty"`       // 位置描述
+		CardUser    string  `json:"cardUser,omitempty"`    // 名片用户id
+		CardName    string  `json:"cardName,omitempty"`    // 名片用户昵称
+		CardAlias   string  `json:"cardAlias,omitempty"`   // 名片用户微信号
 	}
 	Revoke struct {
 		OldMsgID   string `json:"oldMsgID"`
@@ -0,0 +1,17 @@
+package session
+
+import "time"
+
+// Session 插件多轮会话。插件占用会话后，同一用户在同一群的后续消息将直接交给该插件处理
+type Session interface {
+	// Claim 占用会话，timeout内无新消息时自动释放
+	Claim(timeout time.Duration)
+	// Release 释放会话
+	Release()
+	// Active 当前消息是否来自会话
+	Active() bool
+	// Get 获取会话数据
+	Get(key string) (interface{}, bool)
+	// Set 设置会话数据，会话释放后清除
+	Set(key string, value interface{})
+}
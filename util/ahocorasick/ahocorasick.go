@@ -0,0 +1,109 @@
+package ahocorasick
+
+import "strings"
+
+type node struct {
+	children map[rune]*node
+	fail     *node
+	output   []int // 以当前节点结尾的模式串下标
+}
+
+// Matcher 多模式串匹配器
+type Matcher struct {
+	root     *node
+	patterns []string
+}
+
+// NewMatcher 根据模式串构建匹配器，匹配不区分大小写
+func NewMatcher(patterns []string) *Matcher {
+	m := &Matcher{root: &node{children: map[rune]*node{}}}
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == "" {
+			continue
+		}
+		current := m.root
+		for _, r := range pattern {
+			next, ok := current.children[r]
+			if !ok {
+				next = &node{children: map[rune]*node{}}
+				current.children[r] = next
+			}
+			current = next
+		}
+		current.output = append(current.output, len(m.patterns))
+		m.patterns = append(m.patterns, pattern)
+	}
+	m.build()
+	return m
+}
+
+// build 按层序构建失配指针
+func (m *Matcher) build() {
+	queue := make([]*node, 0, len(m.root.children))
+	for _, child := range m.root.children {
+		child.fail = m.root
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for r, child := range current.children {
+			fail := current.fail
+			for fail != nil && fail.children[r] == nil {
+				fail = fail.fail
+			}
+			if fail == nil {
+				child.fail = m.root
+			} else {
+				child.fail = fail.children[r]
+				child.output = append(child.output, child.fail.output...)
+			}
+			queue = append(queue, child)
+		}
+	}
+}
+
+// Len 模式串数量
+func (m *Matcher) Len() int {
+	return len(m.patterns)
+}
+
+// FindAll 返回文本中出现的全部模式串，结果去重
+func (m *Matcher) FindAll(text string) []string {
+	var result []string
+	seen := map[int]struct{}{}
+	current := m.root
+	for _, r := range strings.ToLower(text) {
+		for current != m.root && current.children[r] == nil {
+			current = current.fail
+		}
+		if next, ok := current.children[r]; ok {
+			current = next
+		}
+		for _, i := range current.output {
+			if _, ok := seen[i]; !ok {
+				seen[i] = struct{}{}
+				result = append(result, m.patterns[i])
+			}
+		}
+	}
+	return result
+}
+
+// Contains 判断文本中是否出现任一模式串
+func (m *Matcher) Contains(text string) bool {
+	current := m.root
+	for _, r := range strings.ToLower(text) {
+		for current != m.root && current.children[r] == nil {
+			current = current.fail
+		}
+		if next, ok := current.children[r]; ok {
+			current = next
+		}
+		if len(current.output) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package ahocorasick
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMatcher_FindAll(t *testing.T) {
+	matcher := NewMatcher([]string{"he", "she", "his", "hers", "广告", "加微信"})
+	cases := []struct {
+		text   string
+		expect []string
+	}{
+		{"ushers", []string{"he", "hers", "she"}},
+		{"SHE said", []string{"he", "she"}},
+		{"低价广告，加微信咨询", []string{"加微信", "广告"}},
+		{"正常聊天", nil},
+	}
+	for _, c := range cases {
+		result := matcher.FindAll(c.text)
+		sort.Strings(result)
+		if !reflect.DeepEqual(result, c.expect) {
+			t.Errorf("%s: 期望%v, 实际%v", c.text, c.expect, result)
+		}
+		if matcher.Contains(c.text) != (len(c.expect) > 0) {
+			t.Errorf("%s: Contains结果错误", c.text)
+		}
+	}
+}
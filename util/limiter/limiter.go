@@ -3,18 +3,24 @@ package limiter
 import (
 	"golang.org/x/time/rate"
 	"sync"
+	"time"
 )
 
 type Limiter struct {
-	limiterMap map[string]*rate.Limiter
+	limiterMap map[string]*entry
 	mu         *sync.RWMutex
 	r          rate.Limit
 	b          int
 }
 
+type entry struct {
+	limiter    *rate.Limiter
+	lastAccess time.Time
+}
+
 func NewLimiter(r rate.Limit, b int) *Limiter {
 	i := &Limiter{
-		limiterMap: make(map[string]*rate.Limiter),
+		limiterMap: make(map[string]*entry),
 		mu:         &sync.RWMutex{},
 		r:          r,
 		b:          b,
@@ -26,32 +32,71 @@ func NewLimiter(r rate.Limit, b int) *Limiter {
 func (i *Limiter) Add(key string) *rate.Limiter {
 	i.mu.Lock()
 	defer i.mu.Unlock()
-	return i.add(key)
+	return i.add(key, i.r, i.b)
 }
 
-func (i *Limiter) add(key string) *rate.Limiter {
-	limiter := rate.NewLimiter(i.r, i.b)
-	i.limiterMap[key] = limiter
+func (i *Limiter) add(key string, r rate.Limit, b int) *rate.Limiter {
+	limiter := rate.NewLimiter(r, b)
+	i.limiterMap[key] = &entry{limiter: limiter, lastAccess: time.Now()}
 	return limiter
 }
 
 func (i *Limiter) Get(key string) *rate.Limiter {
 	i.mu.Lock()
-	limiter, exists := i.limiterMap[key]
+	e, exists := i.limiterMap[key]
 	if !exists {
 		i.mu.Unlock()
 		return i.Add(key)
 	}
+	e.lastAccess = time.Now()
 	i.mu.Unlock()
-	return limiter
+	return e.limiter
 }
 
 func (i *Limiter) GetOrAdd(key string) *rate.Limiter {
+	return i.GetOrAddWith(key, i.r, i.b)
+}
+
+// GetOrAddWith 获取限流器，不存在时按指定速率创建。已存在的限流器会同步更新速率
+func (i *Limiter) GetOrAddWith(key string, r rate.Limit, b int) *rate.Limiter {
 	i.mu.Lock()
 	defer i.mu.Unlock()
-	if limiter, exists := i.limiterMap[key]; exists {
-		return limiter
+	if e, exists := i.limiterMap[key]; exists {
+		e.lastAccess = time.Now()
+		if e.limiter.Limit() != r {
+			e.limiter.SetLimit(r)
+		}
+		if e.limiter.Burst() != b {
+			e.limiter.SetBurst(b)
+		}
+		return e.limiter
 	} else {
-		return i.add(key)
+		return i.add(key, r, b)
+	}
+}
+
+// Evict 清除超过idle时长未使用的限流器，返回清除数量
+func (i *Limiter) Evict(idle time.Duration) int {
+	return i.EvictFunc(func(string) time.Duration { return idle })
+}
+
+// EvictFunc 清除未使用时长超过idle(key)的限流器，返回清除数量
+func (i *Limiter) EvictFunc(idle func(key string) time.Duration) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	count := 0
+	for key, e := range i.limiterMap {
+		if time.Since(e.lastAccess) > idle(key) {
+			delete(i.limiterMap, key)
+			count++
+		}
 	}
+	return count
+}
+
+// Len 当前限流器数量
+func (i *Limiter) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.limiterMap)
 }
@@ -0,0 +1,210 @@
+package timeparse
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	numberPattern   = `([0-9]+|[零一二两三四五六七八九十百]+)`
+	relativePattern = regexp.MustCompile(`^(` + numberPattern + `(个)?(半)?|半)(秒钟?|分钟?|刻钟?|个?小时|个?钟头|天|周|个?星期)(之?后|以后)`)
+	datePattern     = regexp.MustCompile(`^(([0-9]{4})[-/年])?([0-9]{1,2})[-/月]([0-9]{1,2})[日号]?`)
+	dayPattern      = regexp.MustCompile(`^(今天|今晚|明天|明晚|后天|大后天)`)
+	weekPattern     = regexp.MustCompile(`^(下下|下|这|本)?(周|星期|礼拜)([一二三四五六日天1-7])`)
+	periodPattern   = regexp.MustCompile(`^(凌晨|早上|早晨|上午|中午|下午|傍晚|晚上|夜里)`)
+	clockPattern    = regexp.MustCompile(`^` + numberPattern + `[点时:：](半|一刻|三刻|` + numberPattern + `分?)?`)
+)
+
+var weekdays = map[string]int{"日": 0, "天": 0, "一": 1, "二": 2, "三": 3, "四": 4, "五": 5, "六": 6}
+
+var digits = map[rune]int{'零': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+
+// parseNumber 解析阿拉伯数字或一百以内的中文数字
+func parseNumber(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+	result, current := 0, 0
+	for _, r := range s {
+		switch {
+		case r == '十':
+			if current == 0 {
+				current = 1
+			}
+			result += current * 10
+			current = 0
+		case r == '百':
+			if current == 0 {
+				current = 1
+			}
+			result += current * 100
+			current = 0
+		default:
+			d, ok := digits[r]
+			if !ok {
+				return 0, errors.New("无法识别的数字:" + s)
+			}
+			current = current*10 + d
+		}
+	}
+	return result + current, nil
+}
+
+// Parse 从文本开头解析中文时间表达式，返回解析出的时间和剩余文本
+// 支持:10分钟后、半小时后、两天后、明天9点、后天下午3点半、周五18:00、下周一、12月25日、2024-01-01 08:00、晚上8点
+func Parse(text string, now time.Time) (time.Time, string, error) {
+	text = strings.TrimSpace(text)
+	if m := relativePattern.FindStringSubmatch(text); m != nil {
+		rest := strings.TrimSpace(text[len(m[0]):])
+		var amount float64
+		if m[1] == "半" {
+			amount = 0.5
+		} else {
+			n, err := parseNumber(m[2])
+			if err != nil {
+				return time.Time{}, text, err
+			}
+			amount = float64(n)
+			if m[4] != "" {
+				amount += 0.5
+			}
+		}
+		var unit time.Duration
+		switch unitText := strings.TrimPrefix(m[5], "个"); {
+		case strings.HasPrefix(unitText, "秒"):
+			unit = time.Second
+		case strings.HasPrefix(unitText, "分"):
+			unit = time.Minute
+		case strings.HasPrefix(unitText, "刻"):
+			unit = 15 * time.Minute
+		case unitText == "小时" || unitText == "钟头":
+			unit = time.Hour
+		case unitText == "天":
+			unit = 24 * time.Hour
+		default:
+			unit = 7 * 24 * time.Hour
+		}
+		return now.Add(time.Duration(amount * float64(unit))), rest, nil
+	}
+
+	rest := text
+	date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	dateSet, evening := false, false
+	if m := datePattern.FindStringSubmatch(rest); m != nil {
+		year := now.Year()
+		if m[2] != "" {
+			year, _ = strconv.Atoi(m[2])
+		}
+		month, _ := strconv.Atoi(m[3])
+		day, _ := strconv.Atoi(m[4])
+		if month < 1 || month > 12 || day < 1 || day > 31 {
+			return time.Time{}, text, errors.New("日期格式错误")
+		}
+		date = time.Date(year, time.Month(month), day, 0, 0, 0, 0, now.Location())
+		if m[2] == "" && date.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())) {
+			date = date.AddDate(1, 0, 0)
+		}
+		dateSet = true
+		rest = strings.TrimSpace(rest[len(m[0]):])
+	} else if m := dayPattern.FindStringSubmatch(rest); m != nil {
+		switch m[1] {
+		case "明天", "明晚":
+			date = date.AddDate(0, 0, 1)
+		case "后天":
+			date = date.AddDate(0, 0, 2)
+		case "大后天":
+			date = date.AddDate(0, 0, 3)
+		}
+		evening = strings.HasSuffix(m[1], "晚")
+		dateSet = true
+		rest = strings.TrimSpace(rest[len(m[0]):])
+	} else if m := weekPattern.FindStringSubmatch(rest); m != nil {
+		target, ok := weekdays[m[3]]
+		if !ok {
+			target, _ = strconv.Atoi(m[3])
+			target %= 7
+		}
+		// 以周一为一周的开始
+		current := (int(now.Weekday()) + 6) % 7
+		offset := (target+6)%7 - current
+		switch m[1] {
+		case "下":
+			offset += 7
+		case "下下":
+			offset += 14
+		case "":
+			if offset < 0 {
+				offset += 7
+			}
+		}
+		date = date.AddDate(0, 0, offset)
+		dateSet = true
+		rest = strings.TrimSpace(rest[len(m[0]):])
+	}
+
+	period := ""
+	if m := periodPattern.FindStringSubmatch(rest); m != nil {
+		period = m[1]
+		rest = strings.TrimSpace(rest[len(m[0]):])
+	} else if evening {
+		period = "晚上"
+	}
+
+	hour, minute := 9, 0
+	clockSet := false
+	if m := clockPattern.FindStringSubmatch(rest); m != nil {
+		h, err := parseNumber(m[1])
+		if err != nil {
+			return time.Time{}, text, err
+		}
+		hour = h
+		switch m[2] {
+		case "":
+		case "半":
+			minute = 30
+		case "一刻":
+			minute = 15
+		case "三刻":
+			minute = 45
+		default:
+			if minute, err = parseNumber(m[3]); err != nil {
+				return time.Time{}, text, err
+			}
+		}
+		clockSet = true
+		rest = strings.TrimSpace(rest[len(m[0]):])
+	} else if period != "" {
+		hour = map[string]int{"凌晨": 3, "早上": 8, "早晨": 8, "上午": 9, "中午": 12, "下午": 15, "傍晚": 18, "晚上": 20, "夜里": 22}[period]
+		clockSet = true
+	}
+	if !dateSet && !clockSet {
+		return time.Time{}, text, errors.New("未识别到时间")
+	}
+	switch period {
+	case "下午", "傍晚", "晚上", "夜里":
+		if hour < 12 {
+			hour += 12
+		}
+	case "中午":
+		if hour < 6 {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return time.Time{}, text, errors.New("时间格式错误")
+	}
+	result := date.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	if !dateSet && !result.After(now) {
+		// 未指定日期且今天的时间已过，顺延到明天
+		if period == "" && hour < 12 && result.Add(12*time.Hour).After(now) {
+			result = result.Add(12 * time.Hour)
+		} else {
+			result = result.AddDate(0, 0, 1)
+		}
+	}
+	rest = strings.TrimLeft(rest, " ，,：:")
+	return result, rest, nil
+}
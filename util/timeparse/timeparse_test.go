@@ -0,0 +1,47 @@
+package timeparse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// 2024-01-03 周三 10:20
+	now := time.Date(2024, 1, 3, 10, 20, 0, 0, time.Local)
+	cases := []struct {
+		text   string
+		expect time.Time
+		rest   string
+	}{
+		{"10分钟后 开会", now.Add(10 * time.Minute), "开会"},
+		{"半小时后 喝水", now.Add(30 * time.Minute), "喝水"},
+		{"两个半小时后 下班", now.Add(150 * time.Minute), "下班"},
+		{"三天后 还书", now.AddDate(0, 0, 3), "还书"},
+		{"明天9点 交周报", time.Date(2024, 1, 4, 9, 0, 0, 0, time.Local), "交周报"},
+		{"后天下午3点半 面试", time.Date(2024, 1, 5, 15, 30, 0, 0, time.Local), "面试"},
+		{"明晚八点 看球", time.Date(2024, 1, 4, 20, 0, 0, 0, time.Local), "看球"},
+		{"周五18:00 聚餐", time.Date(2024, 1, 5, 18, 0, 0, 0, time.Local), "聚餐"},
+		{"下周一 例会", time.Date(2024, 1, 8, 9, 0, 0, 0, time.Local), "例会"},
+		{"周一 例会", time.Date(2024, 1, 8, 9, 0, 0, 0, time.Local), "例会"},
+		{"12月25日 圣诞", time.Date(2024, 12, 25, 9, 0, 0, 0, time.Local), "圣诞"},
+		{"2024-02-01 08:00 出发", time.Date(2024, 2, 1, 8, 0, 0, 0, time.Local), "出发"},
+		{"晚上8点 健身", time.Date(2024, 1, 3, 20, 0, 0, 0, time.Local), "健身"},
+		{"9点 早会", time.Date(2024, 1, 3, 21, 0, 0, 0, time.Local), "早会"},
+		{"下午2点15分 签到", time.Date(2024, 1, 3, 14, 15, 0, 0, time.Local), "签到"},
+		{"三点一刻 开会", time.Date(2024, 1, 3, 15, 15, 0, 0, time.Local), "开会"},
+		{"下午3点三刻 下班", time.Date(2024, 1, 3, 15, 45, 0, 0, time.Local), "下班"},
+	}
+	for _, c := range cases {
+		result, rest, err := Parse(c.text, now)
+		if err != nil {
+			t.Errorf("%s: %v", c.text, err)
+			continue
+		}
+		if !result.Equal(c.expect) || rest != c.rest {
+			t.Errorf("%s: 期望%s %s, 实际%s %s", c.text, c.expect.Format(time.DateTime), c.rest, result.Format(time.DateTime), rest)
+		}
+	}
+	if _, _, err := Parse("开会", now); err == nil {
+		t.Error("无时间的文本应返回错误")
+	}
+}
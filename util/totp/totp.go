@@ -2,32 +2,134 @@ package totp
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/base32"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash"
+	"net/url"
+	"strings"
 	"time"
 )
 
-func TOTPToken(secret string, timestamp int64) (string, error) {
-	return totpToken(secret, 30, timestamp)
+const (
+	AlgorithmSHA1   = "SHA1"
+	AlgorithmSHA256 = "SHA256"
+)
+
+// Key 动态密码配置
+type Key struct {
+	Secret    string // base32格式的密钥
+	Algorithm string // 摘要算法,SHA1或SHA256
+	Digits    int    // 密码位数,6或8
+	Period    int    // 时间步长,单位秒
 }
 
-func totpToken(secret string, offsetSize int, timestamp int64) (string, error) {
-	key := make([]byte, base32.StdEncoding.DecodedLen(len(secret)))
-	_, err := base32.StdEncoding.Decode(key, []byte(secret))
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret 生成随机密钥
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return secretEncoding.EncodeToString(buf), nil
+}
+
+// NewKey 创建动态密码配置，未设置的参数使用默认值
+func NewKey(secret string, algorithm string, digits int) Key {
+	key := Key{Secret: secret, Algorithm: strings.ToUpper(algorithm), Digits: digits, Period: 30}
+	if key.Algorithm != AlgorithmSHA256 {
+		key.Algorithm = AlgorithmSHA1
+	}
+	if key.Digits != 8 {
+		key.Digits = 6
+	}
+	return key
+}
+
+// Counter 获取时间戳对应的时间步
+func (k Key) Counter(timestamp int64) int64 {
+	return timestamp / int64(k.Period)
+}
+
+// Token 生成时间戳对应的动态密码
+func (k Key) Token(timestamp int64) (string, error) {
+	return k.token(k.Counter(timestamp))
+}
+
+// Verify 校验动态密码，允许前后skew个时间步的偏差，返回匹配的时间步
+func (k Key) Verify(code string, skew int) (int64, bool) {
+	if len(code) != k.Digits {
+		return 0, false
+	}
+	counter := k.Counter(time.Now().Unix())
+	for i := -skew; i <= skew; i++ {
+		if verifyCode, err := k.token(counter + int64(i)); err == nil && hmac.Equal([]byte(verifyCode), []byte(code)) {
+			return counter + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// URI 生成认证器使用的otpauth地址
+func (k Key) URI(issuer string, account string) string {
+	params := url.Values{}
+	params.Set("secret", strings.TrimRight(k.Secret, "="))
+	params.Set("issuer", issuer)
+	params.Set("algorithm", k.Algorithm)
+	params.Set("digits", fmt.Sprint(k.Digits))
+	params.Set("period", fmt.Sprint(k.Period))
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: params.Encode(),
+	}).String()
+}
+
+func (k Key) token(counter int64) (string, error) {
+	key, err := secretEncoding.DecodeString(strings.ToUpper(strings.TrimRight(k.Secret, "=")))
 	if err != nil {
 		return "", err
 	}
+	var hashFn func() hash.Hash
+	switch k.Algorithm {
+	case AlgorithmSHA1, "":
+		hashFn = sha1.New
+	case AlgorithmSHA256:
+		hashFn = sha256.New
+	default:
+		return "", errors.New("不支持的摘要算法:" + k.Algorithm)
+	}
+	digits := k.Digits
+	if digits == 0 {
+		digits = 6
+	}
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
 
 	message := make([]byte, 8)
-	binary.BigEndian.PutUint64(message, uint64(timestamp/int64(offsetSize)))
-	hmacSha1 := hmac.New(sha1.New, key)
-	hmacSha1.Write(message)
-	hash := hmacSha1.Sum([]byte{})
-	offset := hash[len(hash)-1] & 0xF
-	truncatedHash := hash[offset : offset+4]
-	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(truncatedHash)&0x7FFFFFFF)%1000000), nil
+	binary.BigEndian.PutUint64(message, uint64(counter))
+	mac := hmac.New(hashFn, key)
+	mac.Write(message)
+	sum := mac.Sum([]byte{})
+	offset := sum[len(sum)-1] & 0xF
+	truncatedHash := sum[offset : offset+4]
+	return fmt.Sprintf("%0*d", digits, (binary.BigEndian.Uint32(truncatedHash)&0x7FFFFFFF)%modulo), nil
+}
+
+func TOTPToken(secret string, timestamp int64) (string, error) {
+	return totpToken(secret, 30, timestamp)
+}
+
+func totpToken(secret string, offsetSize int, timestamp int64) (string, error) {
+	return Key{Secret: secret, Algorithm: AlgorithmSHA1, Digits: 6, Period: offsetSize}.Token(timestamp)
 }
 
 func TOTPVerify(secret string, offsetSize int, code string) bool {
@@ -3,6 +3,7 @@ package totp
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestTOTPToken(t *testing.T) {
@@ -19,3 +20,42 @@ func TestTOTPToken(t *testing.T) {
 		t.Log("验证通过")
 	}
 }
+
+func TestKeyToken(t *testing.T) {
+	cases := []struct {
+		key   Key
+		token string
+	}{
+		{NewKey("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", AlgorithmSHA1, 8), "94287082"},
+		{NewKey("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA====", AlgorithmSHA256, 8), "46119246"},
+	}
+	for _, c := range cases {
+		token, err := c.key.Token(59)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != c.token {
+			t.Errorf("%s: 期望%s, 实际%s", c.key.Algorithm, c.token, token)
+		}
+	}
+}
+
+func TestKeyVerify(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := NewKey(secret, "", 0)
+	token, _ := key.Token(time.Now().Unix())
+	counter, ok := key.Verify(token, 1)
+	if !ok {
+		t.Fatal("验证失败")
+	}
+	if counter != key.Counter(time.Now().Unix()) && counter != key.Counter(time.Now().Unix())-1 {
+		t.Error("时间步不匹配", counter)
+	}
+	if _, ok := key.Verify("00000", 1); ok {
+		t.Error("位数错误的密码不应通过")
+	}
+	t.Log(key.URI("wechat-assistant", "test"))
+}
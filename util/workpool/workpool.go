@@ -0,0 +1,162 @@
+package workpool
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// Pool 固定数量的工作协程池，同一个key的任务按提交顺序依次执行，不同key之间轮流执行
+type Pool struct {
+	mutex       sync.Mutex
+	notEmpty    *sync.Cond
+	workers     int
+	capacity    int
+	keyCapacity int
+	queues      map[string][]func() // 每个key等待执行的任务
+	ready       []string            // 等待工作协程处理的key
+	running     map[string]bool     // 正在执行任务的key
+	dropped     map[string]uint64   // 每个key被拒绝的任务数
+	queued      int
+	processed   uint64
+	rejected    uint64
+	closed      bool
+	wg          sync.WaitGroup
+}
+
+// Stats 队列指标
+type Stats struct {
+	Workers   int               `json:"workers"`   // 工作协程数
+	Active    int               `json:"active"`    // 正在执行的任务数
+	Queued    int               `json:"queued"`    // 排队中的任务数
+	Capacity  int               `json:"capacity"`  // 排队容量
+	Processed uint64            `json:"processed"` // 已完成任务数
+	Rejected  uint64            `json:"rejected"`  // 队列已满被拒绝的任务数
+	Depths    map[string]int    `json:"depths"`    // 每个key的排队任务数
+	Dropped   map[string]uint64 `json:"dropped"`   // 每个key被拒绝的任务数
+}
+
+// New 创建协程池，workers为工作协程数，capacity为所有key排队任务总数上限，
+// keyCapacity为单个key排队任务数上限，避免单个key占满队列
+func New(workers int, capacity int, keyCapacity int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+	if keyCapacity < 1 || keyCapacity > capacity {
+		keyCapacity = capacity
+	}
+	p := &Pool{
+		workers:     workers,
+		capacity:    capacity,
+		keyCapacity: keyCapacity,
+		queues:      map[string][]func(){},
+		running:     map[string]bool{},
+		dropped:     map[string]uint64{},
+	}
+	p.notEmpty = sync.NewCond(&p.mutex)
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// TrySubmit 提交任务，队列或key的排队数已满时不等待直接拒绝，返回任务是否已入队
+func (p *Pool) TrySubmit(key string, task func()) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed || p.queued >= p.capacity || len(p.queues[key]) >= p.keyCapacity {
+		p.rejected++
+		p.dropped[key]++
+		return false
+	}
+	p.queues[key] = append(p.queues[key], task)
+	p.queued++
+	// 正在执行或已在等待列表中的key无需重复加入
+	if !p.running[key] && len(p.queues[key]) == 1 {
+		p.ready = append(p.ready, key)
+		p.notEmpty.Signal()
+	}
+	return true
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for {
+		p.mutex.Lock()
+		for len(p.ready) == 0 && !p.closed {
+			p.notEmpty.Wait()
+		}
+		if len(p.ready) == 0 {
+			p.mutex.Unlock()
+			return
+		}
+		key := p.ready[0]
+		p.ready = p.ready[1:]
+		task := p.queues[key][0]
+		p.queues[key] = p.queues[key][1:]
+		p.running[key] = true
+		p.queued--
+		p.mutex.Unlock()
+
+		p.run(task)
+
+		p.mutex.Lock()
+		delete(p.running, key)
+		p.processed++
+		// 还有任务时排到末尾，避免单个key占用工作协程
+		if len(p.queues[key]) > 0 {
+			p.ready = append(p.ready, key)
+			p.notEmpty.Signal()
+		} else {
+			delete(p.queues, key)
+		}
+		p.mutex.Unlock()
+	}
+}
+
+func (p *Pool) run(task func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Println("任务执行异常", err, string(debug.Stack()))
+		}
+	}()
+	task()
+}
+
+// Stats 获取队列指标
+func (p *Pool) Stats() Stats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	stats := Stats{
+		Workers:   p.workers,
+		Active:    len(p.running),
+		Queued:    p.queued,
+		Capacity:  p.capacity,
+		Processed: p.processed,
+		Rejected:  p.rejected,
+		Depths:    make(map[string]int, len(p.queues)),
+		Dropped:   make(map[string]uint64, len(p.dropped)),
+	}
+	for key, count := range p.dropped {
+		stats.Dropped[key] = count
+	}
+	for key, queue := range p.queues {
+		if len(queue) > 0 {
+			stats.Depths[key] = len(queue)
+		}
+	}
+	return stats
+}
+
+// Close 停止接收任务，等待已入队的任务执行完成
+func (p *Pool) Close() {
+	p.mutex.Lock()
+	p.closed = true
+	p.notEmpty.Broadcast()
+	p.mutex.Unlock()
+	p.wg.Wait()
+}
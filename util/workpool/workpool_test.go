@@ -0,0 +1,83 @@
+package workpool
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoolOrder(t *testing.T) {
+	p := New(4, 100, 0)
+	var mutex sync.Mutex
+	results := map[string][]int{}
+	for i := 0; i < 20; i++ {
+		for _, key := range []string{"a", "b", "c"} {
+			i, key := i, key
+			if !p.TrySubmit(key, func() {
+				mutex.Lock()
+				results[key] = append(results[key], i)
+				mutex.Unlock()
+			}) {
+				t.Fatal("submit rejected")
+			}
+		}
+	}
+	p.Close()
+	for key, values := range results {
+		if len(values) != 20 {
+			t.Fatalf("%s: got %d tasks", key, len(values))
+		}
+		for i, v := range values {
+			if v != i {
+				t.Fatalf("%s: out of order %v", key, values)
+			}
+		}
+	}
+}
+
+func TestPoolBackpressure(t *testing.T) {
+	p := New(1, 3, 2)
+	block := make(chan struct{})
+	p.TrySubmit("a", func() { <-block })
+	// 等待第一个任务开始执行
+	for p.Stats().Active == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if !p.TrySubmit("a", func() {}) || !p.TrySubmit("a", func() {}) {
+		t.Fatal("key queue should accept two tasks")
+	}
+	if p.TrySubmit("a", func() {}) {
+		t.Fatal("key queue should be full")
+	}
+	if !p.TrySubmit("b", func() {}) {
+		t.Fatal("full key should not block other keys")
+	}
+	if p.TrySubmit("c", func() {}) {
+		t.Fatal("queue should be full")
+	}
+	if stats := p.Stats(); stats.Rejected != 2 || stats.Queued != 3 || stats.Depths["a"] != 2 ||
+		stats.Dropped["a"] != 1 || stats.Dropped["c"] != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	close(block)
+	p.Close()
+	if stats := p.Stats(); stats.Processed != 4 {
+		t.Fatalf("unexpected processed %d", stats.Processed)
+	}
+}
+
+func TestPoolIsolation(t *testing.T) {
+	p := New(2, 100, 0)
+	block := make(chan struct{})
+	done := make(chan struct{})
+	p.TrySubmit("slow", func() { <-block })
+	p.TrySubmit("slow", func() {})
+	p.TrySubmit("fast", func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("slow key blocked other keys")
+	}
+	close(block)
+	p.Close()
+}